@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -9,10 +10,15 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
 
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
 	"github.com/brandon-kong/parkshare/apps/api/internal/database"
 	"github.com/brandon-kong/parkshare/apps/api/internal/features/auth"
 	"github.com/brandon-kong/parkshare/apps/api/internal/features/health"
 	"github.com/brandon-kong/parkshare/apps/api/internal/features/spot"
+	"github.com/brandon-kong/parkshare/apps/api/internal/features/user"
+	"github.com/brandon-kong/parkshare/apps/api/internal/mail"
+	"github.com/brandon-kong/parkshare/apps/api/internal/sms"
+	"github.com/brandon-kong/parkshare/apps/api/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
@@ -27,6 +33,32 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatal(err)
+	}
+	auth.LoadProviders()
+
+	if err := auth.LoadPasswordParams(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := mail.Setup(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := storage.Setup(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := sms.Setup(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Deleted accounts are purged once their grace period is over
+	go user.RunPurger(context.Background(), time.Hour)
+	// Expired login throttles and OAuth nonces are cleared out the same way
+	go auth.RunCleanup(context.Background(), time.Hour)
+
 	router := chi.NewRouter()
 
 	// Middleware
@@ -34,8 +66,10 @@ func main() {
 		log.Printf("Using CORS\n")
 		router.Use(cors.Handler(cors.Options{
 			AllowedOrigins:   []string{"http://localhost:3000"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			// Lets the web app show that an admin is acting as the user
+			ExposedHeaders:   []string{auth.ImpersonatorHeader},
 			AllowCredentials: true,
 		}))
 	}
@@ -43,6 +77,12 @@ func main() {
 	router.Use(middleware.Logger)
 
 	router.Mount("/health", health.Routes())
+	router.Get("/.well-known/jwks.json", auth.JWKSHandler)
+	router.Get("/tiles/spots/{z}/{x}/{y}.mvt", spot.Tile)
+
+	if uploads, ok := storage.Handler(); ok {
+		router.Handle("/uploads/*", http.StripPrefix("/uploads", uploads))
+	}
 
 	router.Route("/api/v1/auth", func(r chi.Router) {
 		r.Use(httprate.LimitByIP(10, time.Minute))
@@ -50,10 +90,33 @@ func main() {
 	})
 
 	router.Route("/api/v1", func(r chi.Router) {
-		r.Use(auth.Middleware)
+		r.Mount("/users", user.PublicRoutes())
+
+		// Spots can be browsed signed out; writes check for a user themselves
+		r.With(auth.OptionalMiddleware).Mount("/spots", spot.Routes())
+
+		// All routes in this group require auth
+		r.Group(func(r chi.Router) {
+			r.Use(auth.Middleware)
+
+			// Account management is for the user themselves, not their API keys
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RejectAPIKeys)
+				r.Mount("/me/identities", auth.IdentityRoutes())
+				r.Mount("/me/sessions", auth.SessionRoutes())
+				r.Post("/me/password", auth.ChangePasswordHandler)
+				r.Mount("/me/mfa", auth.MFARoutes())
+				r.Mount("/me/api-keys", auth.APIKeyRoutes())
+				r.Mount("/me/email", auth.EmailRoutes())
+				r.Mount("/me", user.Routes())
+			})
 
-		// All routes below require auth
-		r.Mount("/spots", spot.Routes())
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(auth.RequirePermission(auth.PermAdminAccess))
+				r.With(auth.RequirePermission(auth.PermAuditRead)).Mount("/audit", audit.Routes())
+				r.Mount("/", auth.AdminRoutes())
+			})
+		})
 	})
 
 	if err := http.ListenAndServe(":5000", router); err != nil {
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	cursor := Cursor{
+		CreatedAt: time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor() error = %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("DecodeCursor() = %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	tests := []string{
+		"not base64!",
+		"bm8tc2VwYXJhdG9y",            // "no-separator"
+		"eWVzdGVyZGF5fG5vdC1hLXV1aWQ", // "yesterday|not-a-uuid"
+	}
+
+	for _, s := range tests {
+		if _, err := DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	actor := uuid.New()
+	cursor := Cursor{CreatedAt: time.Now().UTC(), ID: uuid.New()}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantField string
+		check     func(t *testing.T, f Filter)
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			check: func(t *testing.T, f Filter) {
+				if f.Limit != defaultPageSize || f.ActorID != nil || f.After != nil {
+					t.Errorf("filter = %+v, want defaults", f)
+				}
+			},
+		},
+		{
+			name:  "all filters",
+			query: "action=spot.deleted&actor_id=" + actor.String() + "&target_type=spot&target_id=42&since=2026-01-01T00:00:00Z&limit=10&cursor=" + cursor.Encode(),
+			check: func(t *testing.T, f Filter) {
+				if f.Action != SpotDeleted || f.TargetType != "spot" || f.TargetID != "42" || f.Limit != 10 {
+					t.Errorf("filter = %+v", f)
+				}
+				if f.ActorID == nil || *f.ActorID != actor {
+					t.Errorf("actor = %v, want %v", f.ActorID, actor)
+				}
+				if f.Since == nil || f.After == nil || f.After.ID != cursor.ID {
+					t.Errorf("since/cursor not parsed: %+v", f)
+				}
+			},
+		},
+		{name: "bad actor", query: "actor_id=me", wantField: "actor_id"},
+		{name: "bad since", query: "since=yesterday", wantField: "since"},
+		{name: "bad until", query: "until=2026-13-01", wantField: "until"},
+		{name: "limit too large", query: "limit=1000", wantField: "limit"},
+		{name: "limit zero", query: "limit=0", wantField: "limit"},
+		{name: "bad cursor", query: "cursor=abc", wantField: "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, errs := ParseFilter(q)
+			if tt.wantField != "" {
+				if _, ok := errs[tt.wantField]; !ok {
+					t.Errorf("errors = %v, want one for %s", errs, tt.wantField)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			tt.check(t, filter)
+		})
+	}
+}
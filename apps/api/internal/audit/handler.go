@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"net/http"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/go-chi/chi/v5"
+)
+
+// Routes serves the audit log. Mount it behind an admin permission check.
+func Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", List)
+	return r
+}
+
+type ListResponse struct {
+	Events     []models.AuditEvent `json:"events"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// List returns audit events, newest first. Filter with action, actor_id,
+// impersonator_id, target_type, target_id, ip, since and until; page with
+// limit and cursor.
+func List(w http.ResponseWriter, r *http.Request) {
+	filter, errs := ParseFilter(r.URL.Query())
+	if len(errs) > 0 {
+		util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":  "Validation failed",
+			"fields": errs,
+		})
+		return
+	}
+
+	events, next, err := Query(filter)
+	if err != nil {
+		util.WriteError(w, http.StatusInternalServerError, "Failed to fetch audit events")
+		return
+	}
+
+	resp := ListResponse{Events: events}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	util.WriteJSON(w, http.StatusOK, resp)
+}
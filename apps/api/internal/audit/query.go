@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Filter narrows a query of the audit log. Zero values match everything.
+type Filter struct {
+	Action         Action
+	ActorID        *uuid.UUID
+	ImpersonatorID *uuid.UUID
+	TargetType     string
+	TargetID       string
+	IP             string
+	Since          *time.Time
+	Until          *time.Time
+	Limit          int
+	// After continues from the last event of a previous page
+	After *Cursor
+}
+
+// Cursor marks a position in the log, which is ordered newest first
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode returns the cursor as an opaque string for clients
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a string made by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	eventID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: createdAt, ID: eventID}, nil
+}
+
+// ParseFilter reads a filter from query parameters. Problems are returned
+// per parameter.
+func ParseFilter(q url.Values) (Filter, map[string]string) {
+	filter := Filter{
+		Action:     Action(q.Get("action")),
+		TargetType: q.Get("target_type"),
+		TargetID:   q.Get("target_id"),
+		IP:         q.Get("ip"),
+		Limit:      defaultPageSize,
+	}
+	errors := make(map[string]string)
+
+	for _, param := range []string{"actor_id", "impersonator_id"} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		id, err := uuid.Parse(v)
+		if err != nil {
+			errors[param] = "Must be a user ID"
+			continue
+		}
+		if param == "actor_id" {
+			filter.ActorID = &id
+		} else {
+			filter.ImpersonatorID = &id
+		}
+	}
+
+	for _, param := range []string{"since", "until"} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errors[param] = "Must be an RFC 3339 timestamp"
+			continue
+		}
+		if param == "since" {
+			filter.Since = &t
+		} else {
+			filter.Until = &t
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			errors["limit"] = "Must be between 1 and 200"
+		} else {
+			filter.Limit = n
+		}
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := DecodeCursor(v)
+		if err != nil {
+			errors["cursor"] = "Invalid cursor"
+		} else {
+			filter.After = cursor
+		}
+	}
+
+	return filter, errors
+}
+
+// Query returns a page of events matching filter, newest first, and the
+// cursor for the next page if there is one
+func Query(filter Filter) ([]models.AuditEvent, *Cursor, error) {
+	limit := filter.Limit
+	if limit < 1 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+
+	query := database.DB.Model(&models.AuditEvent{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.ImpersonatorID != nil {
+		query = query.Where("impersonator_id = ?", *filter.ImpersonatorID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	if filter.After != nil {
+		query = query.Where("(created_at, id) < (?, ?)", filter.After.CreatedAt, filter.After.ID)
+	}
+
+	// One extra row tells us whether there's another page
+	var events []models.AuditEvent
+	err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&events).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(events) <= limit {
+		return events, nil, nil
+	}
+
+	events = events[:limit]
+	last := events[limit-1]
+	return events, &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/brandon-kong/parkshare/apps/api/internal/models"
 	"gorm.io/driver/postgres"
@@ -37,12 +38,88 @@ func migrate() error {
 		&models.User{},
 		&models.Spot{},
 		&models.SpotPhoto{},
+		&models.RefreshToken{},
+		&models.UserIdentity{},
+		&models.VerificationToken{},
+		&models.TOTPFactor{},
+		&models.RecoveryCode{},
+		&models.LoginThrottle{},
+		&models.OAuthNonce{},
+		&models.Session{},
+		&models.UserRole{},
+		&models.APIKey{},
+		&models.PhoneVerification{},
+		&models.AuditEvent{},
 	)
 
 	if err != nil {
 		return err
 	}
 
+	// Password accounts created before identities existed get their email identity
+	err = DB.Exec(`
+		INSERT INTO user_identities (id, user_id, provider, subject, email, created_at)
+		SELECT gen_random_uuid(), id, ?, lower(email), email, created_at
+		FROM users
+		WHERE password_hash IS NOT NULL
+		ON CONFLICT DO NOTHING`, models.IdentityProviderEmail).Error
+
+	if err != nil {
+		return err
+	}
+
+	// Users created before roles existed get the defaults
+	err = DB.Exec(`
+		INSERT INTO user_roles (user_id, role, created_at)
+		SELECT users.id, defaults.role, now()
+		FROM users CROSS JOIN unnest(?::text[]) AS defaults(role)
+		WHERE NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id)
+		ON CONFLICT DO NOTHING`, roleArray(models.DefaultRoles)).Error
+
+	if err != nil {
+		return err
+	}
+
+	// Spot search filters by distance from a point
+	err = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_spots_location ON spots USING GIST (location)`).Error
+
+	if err != nil {
+		return err
+	}
+
+	// Map viewports and tiles compare against planar lon/lat boxes
+	err = DB.Exec(`CREATE INDEX IF NOT EXISTS idx_spots_location_geometry ON spots USING GIST ((location::geometry))`).Error
+
+	if err != nil {
+		return err
+	}
+
+	// The audit log is append-only, whatever the application tries
+	err = DB.Exec(`
+		CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_events is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+		CREATE TRIGGER audit_events_append_only
+			BEFORE UPDATE OR DELETE ON audit_events
+			FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();`).Error
+
+	if err != nil {
+		return err
+	}
+
 	log.Println("Migrations complete")
 	return nil
-}
\ No newline at end of file
+}
+
+// roleArray formats roles as a Postgres array literal
+func roleArray(roles []models.Role) string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return "{" + strings.Join(names, ",") + "}"
+}
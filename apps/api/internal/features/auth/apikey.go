@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/go-chi/httprate"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid api key")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrScopeNotGranted = errors.New("scope not granted by your roles")
+)
+
+const (
+	apiKeyPrefix = "psk_"
+	// apiKeyPrefixLength is how many hex characters identify a key
+	apiKeyPrefixLength = 12
+
+	defaultAPIKeyRateLimit = 60
+	maxAPIKeyRateLimit     = 1000
+	maxAPIKeyNameLength    = 100
+
+	// apiKeyTouchInterval limits how often last-used is written for a busy key
+	apiKeyTouchInterval = time.Minute
+)
+
+// apiKeyScopes are the permissions a key may be given. Admin permissions
+// are deliberately absent.
+var apiKeyScopes = []Permission{PermSpotsWrite, PermBookingsWrite}
+
+// apiKeyLimiter counts requests per key; each key's own limit is passed in
+// through the request context
+var apiKeyLimiter = httprate.NewRateLimiter(defaultAPIKeyRateLimit, time.Minute)
+
+// newAPIKey returns a key formatted "psk_<prefix>_<secret>" and its prefix
+func newAPIKey() (string, string, error) {
+	b := make([]byte, apiKeyPrefixLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix := hex.EncodeToString(b)
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + prefix + "_" + secret, prefix, nil
+}
+
+// parseAPIKey pulls the lookup prefix out of a presented key
+func parseAPIKey(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != apiKeyPrefixLength || secret == "" {
+		return "", false
+	}
+
+	return prefix, true
+}
+
+func validateCreateAPIKey(req CreateAPIKeyRequest) map[string]string {
+	errors := make(map[string]string)
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		errors["name"] = "Name is required"
+	} else if len(name) > maxAPIKeyNameLength {
+		errors["name"] = "Name is too long"
+	}
+
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			errors["scopes"] = "Unknown scope: " + string(scope)
+			break
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(timeNow()) {
+		errors["expires_at"] = "Expiry must be in the future"
+	}
+
+	if req.RateLimit < 0 || req.RateLimit > maxAPIKeyRateLimit {
+		errors["rate_limit"] = "Rate limit must be between 1 and 1000 requests per minute"
+	}
+
+	return errors
+}
+
+// CreateAPIKey issues a key for a user. A key can only carry scopes the
+// user's roles grant. The returned secret is never stored and can't be shown
+// again.
+func CreateAPIKey(userID uuid.UUID, req CreateAPIKeyRequest) (*models.APIKey, string, error) {
+	roles, err := roleStore.Roles(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	owner := &Claims{UserID: userID, Roles: roles}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !HasPermission(owner, scope) {
+			return nil, "", ErrScopeNotGranted
+		}
+		if !slices.Contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	secret, prefix, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	rateLimit := req.RateLimit
+	if rateLimit == 0 {
+		rateLimit = defaultAPIKeyRateLimit
+	}
+
+	key := &models.APIKey{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Name:       strings.TrimSpace(req.Name),
+		Prefix:     prefix,
+		SecretHash: hashToken(secret),
+		Scopes:     scopes,
+		RateLimit:  rateLimit,
+		ExpiresAt:  req.ExpiresAt,
+	}
+
+	if err := database.DB.Create(key).Error; err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+// ListAPIKeys returns a user's keys, newest first
+func ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// DeleteAPIKey revokes one of a user's keys
+func DeleteAPIKey(userID, keyID uuid.UUID) error {
+	result := database.DB.Where("id = ? AND user_id = ?", keyID, userID).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey checks a presented key and returns the key with claims
+// for its owner. The claims hold the owner's current roles narrowed to the
+// key's scopes.
+func AuthenticateAPIKey(presented string) (*models.APIKey, *Claims, error) {
+	prefix, ok := parseAPIKey(presented)
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	err := database.DB.Where("prefix = ?", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(presented)), []byte(key.SecretHash)) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := timeNow()
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := database.DB.Model(&key).Update("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	roles, err := roleStore.Roles(key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scopes := make([]Permission, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = Permission(scope)
+	}
+
+	claims := &Claims{
+		UserID:    key.UserID,
+		TokenType: TokenTypeAccess,
+		Roles:     roles,
+		APIKeyID:  key.ID,
+		Scopes:    scopes,
+	}
+
+	return &key, claims, nil
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		t.Fatalf("newAPIKey failed: %v", err)
+	}
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Errorf("Key %q should start with %q", key, apiKeyPrefix)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		wantPrefix string
+		wantOK     bool
+	}{
+		{name: "generated key", key: key, wantPrefix: prefix, wantOK: true},
+		{name: "missing prefix", key: strings.TrimPrefix(key, apiKeyPrefix), wantOK: false},
+		{name: "missing secret", key: apiKeyPrefix + prefix + "_", wantOK: false},
+		{name: "short prefix", key: apiKeyPrefix + "abc_secret", wantOK: false},
+		{name: "bearer token", key: "eyJhbGciOiJIUzI1NiJ9.e30.sig", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseAPIKey(tt.key)
+			if ok != tt.wantOK || got != tt.wantPrefix {
+				t.Errorf("parseAPIKey() = %q, %v, want %q, %v", got, ok, tt.wantPrefix, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateCreateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		req       CreateAPIKeyRequest
+		wantField string
+	}{
+		{name: "valid", req: CreateAPIKeyRequest{Name: "Fleet sync", Scopes: []Permission{PermBookingsWrite}, ExpiresAt: &future}},
+		{name: "read only", req: CreateAPIKeyRequest{Name: "Dashboard"}},
+		{name: "missing name", req: CreateAPIKeyRequest{Name: "  "}, wantField: "name"},
+		{name: "admin scope", req: CreateAPIKeyRequest{Name: "x", Scopes: []Permission{PermAdminAccess}}, wantField: "scopes"},
+		{name: "unknown scope", req: CreateAPIKeyRequest{Name: "x", Scopes: []Permission{"spots:everything"}}, wantField: "scopes"},
+		{name: "expired", req: CreateAPIKeyRequest{Name: "x", ExpiresAt: &past}, wantField: "expires_at"},
+		{name: "rate limit too high", req: CreateAPIKeyRequest{Name: "x", RateLimit: maxAPIKeyRateLimit + 1}, wantField: "rate_limit"},
+		{name: "negative rate limit", req: CreateAPIKeyRequest{Name: "x", RateLimit: -1}, wantField: "rate_limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateCreateAPIKey(tt.req)
+			if tt.wantField == "" && len(errs) > 0 {
+				t.Errorf("Expected no errors, got %v", errs)
+			}
+			if tt.wantField != "" {
+				if _, ok := errs[tt.wantField]; !ok {
+					t.Errorf("Expected error on %q, got %v", tt.wantField, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestHasPermission_APIKeyScopes(t *testing.T) {
+	claims := &Claims{
+		UserID:   uuid.New(),
+		Roles:    []models.Role{models.RoleRenter, models.RoleHost},
+		APIKeyID: uuid.New(),
+		Scopes:   []Permission{PermBookingsWrite},
+	}
+
+	if !HasPermission(claims, PermBookingsWrite) {
+		t.Error("Key should have its granted scope")
+	}
+	if HasPermission(claims, PermSpotsWrite) {
+		t.Error("Key should not have permissions outside its scopes, even if the owner does")
+	}
+
+	// Scopes never add to what the owner's roles allow
+	claims.Roles = []models.Role{models.RoleHost}
+	if HasPermission(claims, PermBookingsWrite) {
+		t.Error("Key should lose a scope the owner no longer holds")
+	}
+}
+
+func TestRejectAPIKeys(t *testing.T) {
+	handler := RejectAPIKeys(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   int
+	}{
+		{name: "user token", claims: &Claims{UserID: uuid.New()}, want: http.StatusOK},
+		{name: "api key", claims: &Claims{UserID: uuid.New(), APIKeyID: uuid.New()}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), UserContextKey, tt.claims))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
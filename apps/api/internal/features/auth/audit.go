@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
+	"github.com/google/uuid"
+)
+
+// Audit records a security event for request r. Unless the entry names an
+// actor, it's attributed to the signed-in caller, to their API key if they
+// used one, and to the admin behind them if they're being impersonated.
+func Audit(r *http.Request, entry audit.Entry) {
+	if claims := GetUserFromContext(r.Context()); claims != nil && entry.ActorID == nil {
+		userID := claims.UserID
+		entry.ActorID = &userID
+		if claims.APIKeyID != uuid.Nil {
+			keyID := claims.APIKeyID
+			entry.APIKeyID = &keyID
+		}
+		if claims.Actor != nil {
+			adminID := claims.Actor.UserID
+			entry.ImpersonatorID = &adminID
+		}
+	}
+	audit.Record(r, entry)
+}
+
+// auditLogin records a finished login. A first factor that still needs an
+// MFA code isn't one; VerifyMFAHandler records it once the code checks out.
+func auditLogin(r *http.Request, userID uuid.UUID, method string, result *LoginResult) {
+	if result != nil && result.Tokens == nil {
+		return
+	}
+	Audit(r, audit.Entry{
+		Action:     audit.LoginSucceeded,
+		ActorID:    &userID,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+		Metadata:   map[string]interface{}{"method": method},
+	})
+}
+
+// auditLoginFailure records a rejected login attempt
+func auditLoginFailure(r *http.Request, method, reason string, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["method"] = method
+	metadata["reason"] = reason
+	Audit(r, audit.Entry{Action: audit.LoginFailed, Metadata: metadata})
+}
+
+// AuditDenied records that the caller was refused an action, on a target if
+// there is one
+func AuditDenied(r *http.Request, targetType, targetID, reason string) {
+	Audit(r, audit.Entry{
+		Action:     audit.PermissionDenied,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Metadata: map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"reason": reason,
+		},
+	})
+}
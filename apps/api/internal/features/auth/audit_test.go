@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// memoryAuditStore keeps audit events in memory so tests can inspect them
+type memoryAuditStore struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+var auditEvents = &memoryAuditStore{}
+
+func (s *memoryAuditStore) Append(event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// last returns the most recent event with the given action
+func (s *memoryAuditStore) last(action audit.Action) *models.AuditEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].Action == string(action) {
+			event := s.events[i]
+			return &event
+		}
+	}
+	return nil
+}
+
+func TestAudit_AttributesToCaller(t *testing.T) {
+	userID, keyID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name      string
+		claims    *Claims
+		wantActor *uuid.UUID
+		wantKey   *uuid.UUID
+	}{
+		{name: "anonymous", claims: nil},
+		{name: "user", claims: &Claims{UserID: userID}, wantActor: &userID},
+		{name: "api key", claims: &Claims{UserID: userID, APIKeyID: keyID}, wantActor: &userID, wantKey: &keyID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/spots/1", nil)
+			r.Header.Set("User-Agent", "test-agent")
+			if tt.claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), UserContextKey, tt.claims))
+			}
+
+			targetID := uuid.NewString()
+			AuditDenied(r, audit.TargetSpot, targetID, "not spot owner")
+
+			event := auditEvents.last(audit.PermissionDenied)
+			if event == nil || event.TargetID != targetID {
+				t.Fatal("expected a permission denied event for the target")
+			}
+			if !sameID(event.ActorID, tt.wantActor) {
+				t.Errorf("actor = %v, want %v", event.ActorID, tt.wantActor)
+			}
+			if !sameID(event.APIKeyID, tt.wantKey) {
+				t.Errorf("api key = %v, want %v", event.APIKeyID, tt.wantKey)
+			}
+			if event.UserAgent != "test-agent" || event.IP == "" {
+				t.Errorf("client = %q %q, want the request's", event.UserAgent, event.IP)
+			}
+		})
+	}
+}
+
+func TestRequirePermission_AuditsDenial(t *testing.T) {
+	handler := RequirePermission(PermAdminAccess)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	claims := &Claims{UserID: uuid.New(), Roles: []models.Role{models.RoleHost}}
+	r := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+	r = r.WithContext(context.WithValue(r.Context(), UserContextKey, claims))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	event := auditEvents.last(audit.PermissionDenied)
+	if event == nil || event.ActorID == nil || *event.ActorID != claims.UserID {
+		t.Fatal("expected the denial to be recorded against the caller")
+	}
+	if event.Metadata["path"] != "/admin/audit" {
+		t.Errorf("path = %v, want /admin/audit", event.Metadata["path"])
+	}
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunCleanup deletes login throttles that have run their course and expired
+// OAuth nonces every interval until ctx is done
+func RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := PurgeLoginThrottles(timeNow())
+		if err != nil {
+			log.Printf("Purging login throttles failed: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Purged %d login throttles\n", n)
+		}
+
+		n, err = PurgeOAuthNonces(timeNow())
+		if err != nil {
+			log.Printf("Purging OAuth nonces failed: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Purged %d OAuth nonces\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
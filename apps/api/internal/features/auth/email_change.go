@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/mail"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email")
+	ErrSameEmail    = errors.New("that is already your email")
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// RequestEmailChange starts moving a user to a new address. Nothing changes
+// until a link sent to the new address is opened; the old address is told
+// about the request.
+func RequestEmailChange(ctx context.Context, userID uuid.UUID, email string) error {
+	email = strings.TrimSpace(email)
+	if _, err := netmail.ParseAddress(email); err != nil {
+		return ErrInvalidEmail
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+
+	if strings.EqualFold(user.Email, email) {
+		return ErrSameEmail
+	}
+
+	taken, err := emailTaken(database.DB, email, userID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrUserExists
+	}
+
+	if err := database.DB.Model(&user).Update("pending_email", email).Error; err != nil {
+		return err
+	}
+
+	secret, err := issueVerificationToken(user.ID, models.TokenPurposeEmailChange, emailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendLink("/auth/confirm-email-change", url.Values{"token": {secret}})
+	err = mail.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your new ParkShare email",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to start using this address for your ParkShare account. It expires in 24 hours.\n\n%s\n\nIf you didn't ask for this you can ignore this email.\n",
+			user.Name, link),
+	})
+	if err != nil {
+		return err
+	}
+
+	return mail.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your ParkShare email is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email on your ParkShare account to %s. It won't change until the new address is confirmed.\n\nIf this wasn't you, change your password right away.\n",
+			user.Name, email),
+	})
+}
+
+// ConfirmEmailChange redeems an email change link, switching the account
+// and its password login over to the new address
+func ConfirmEmailChange(secret string) (*models.User, error) {
+	var user models.User
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, secret, models.TokenPurposeEmailChange)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, "id = ?", token.UserID).Error; err != nil {
+			return err
+		}
+		if user.PendingEmail == nil {
+			return ErrInvalidVerificationToken
+		}
+		email := *user.PendingEmail
+
+		// Someone may have registered the address since the link was sent
+		taken, err := emailTaken(tx, email, user.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrUserExists
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"email":         email,
+			"pending_email": nil,
+			"is_verified":   true,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.UserIdentity{}).
+			Where("user_id = ? AND provider = ?", user.ID, models.IdentityProviderEmail).
+			Updates(map[string]interface{}{"subject": strings.ToLower(email), "email": email}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// emailTaken reports whether another user has, or logs in with, email
+func emailTaken(db *gorm.DB, email string, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).
+		Where("lower(email) = lower(?) AND id <> ?", email, userID).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	identity, err := findIdentity(db, models.IdentityProviderEmail, strings.ToLower(email))
+	if errors.Is(err, ErrIdentityNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return identity.UserID != userID, nil
+}
@@ -2,18 +2,29 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
 	"github.com/brandon-kong/parkshare/apps/api/internal/models"
 	"github.com/brandon-kong/parkshare/apps/api/util"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// OAuthRequest carries proof of an external login: either an ID token the
+// client already received, or an authorization code and its PKCE verifier
 type OAuthRequest struct {
-    Provider  string `json:"provider"`
-    Email     string `json:"email"`
-    Name      string `json:"name"`
-    AvatarURL string `json:"avatar_url"`
+    Provider     string `json:"provider"`
+    IDToken      string `json:"id_token"`
+    Code         string `json:"code"`
+    CodeVerifier string `json:"code_verifier"`
+    // Nonce is the value from /oauth/nonce that the ID token must carry
+    Nonce        string `json:"nonce"`
 }
 
 type RegisterRequest struct {
@@ -31,11 +42,80 @@ type RefreshRequest struct {
     RefreshToken string `json:"refresh_token"`
 }
 
+type VerifyEmailRequest struct {
+    Token string `json:"token"`
+}
+
+type EmailRequest struct {
+    Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+    Token    string `json:"token"`
+    Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password"`
+    NewPassword     string `json:"new_password"`
+}
+
 type AuthResponse struct {
     User   *models.User      `json:"user"`
     Tokens *TokenPair `json:"tokens"`
 }
 
+type MFAChallengeResponse struct {
+    MFARequired bool   `json:"mfa_required"`
+    MFAToken    string `json:"mfa_token"`
+}
+
+type MFAVerifyRequest struct {
+    MFAToken string `json:"mfa_token"`
+    Code     string `json:"code"`
+}
+
+type MFACodeRequest struct {
+    Code string `json:"code"`
+}
+
+type TOTPEnrollmentResponse struct {
+    Secret     string `json:"secret"`
+    OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type CreateAPIKeyRequest struct {
+    Name      string       `json:"name"`
+    Scopes    []Permission `json:"scopes"`
+    ExpiresAt *time.Time   `json:"expires_at"`
+    // RateLimit is requests per minute; zero means the default
+    RateLimit int          `json:"rate_limit"`
+}
+
+// CreateAPIKeyResponse is the only time the full key is returned
+type CreateAPIKeyResponse struct {
+    models.APIKey
+    Key string `json:"key"`
+}
+
+type UpdateRolesRequest struct {
+    Roles []models.Role `json:"roles"`
+}
+
+// ImpersonationResponse is the token an admin uses to act as UserID
+type ImpersonationResponse struct {
+    *Impersonation
+    Impersonating bool      `json:"impersonating"`
+    UserID        uuid.UUID `json:"user_id"`
+}
+
+// SessionResponse is a session as listed to its owner
+type SessionResponse struct {
+    models.Session
+    // Current marks the session the request was made with
+    Current bool `json:"current"`
+}
+
 type ErrorResponse struct {
     Error string `json:"error"`
 }
@@ -46,11 +126,101 @@ func Routes() chi.Router {
     r.Post("/register", Register)
     r.Post("/login", Login)
     r.Post("/refresh", Refresh)
+    r.Post("/logout", Logout)
+    r.Post("/verify-email", VerifyEmail)
+    r.Post("/verify-email/resend", ResendVerification)
+    r.Post("/forgot-password", ForgotPassword)
+    r.Post("/reset-password", ResetPasswordHandler)
+    r.Post("/magic-link", MagicLink)
+    r.Post("/magic-link/verify", VerifyMagicLinkHandler)
+    r.Post("/confirm-email-change", ConfirmEmailChangeHandler)
+    r.Post("/mfa/verify", VerifyMFAHandler)
+	r.Post("/oauth/nonce", OAuthNonce)
 	r.Post("/oauth", OAuth)
 
     return r
 }
 
+// ReauthMaxAge is how recently a user must have logged in to change how they log in
+const ReauthMaxAge = 10 * time.Minute
+
+// MFARoutes manages the caller's second factors. It must be mounted behind
+// Middleware.
+func MFARoutes() chi.Router {
+    r := chi.NewRouter()
+
+    r.Post("/totp/confirm", ConfirmTOTPHandler)
+
+    r.Group(func(r chi.Router) {
+        r.Use(RequireRecentAuth(ReauthMaxAge))
+        r.Post("/totp", EnrollTOTPHandler)
+        r.Delete("/totp", DisableTOTPHandler)
+    })
+
+    return r
+}
+
+// IdentityRoutes manages the caller's linked login methods. It must be
+// mounted behind Middleware.
+func IdentityRoutes() chi.Router {
+    r := chi.NewRouter()
+
+    r.Get("/", Identities)
+
+    r.Group(func(r chi.Router) {
+        r.Use(RequireRecentAuth(ReauthMaxAge))
+        r.Post("/", Link)
+        r.Delete("/{id}", Unlink)
+    })
+
+    return r
+}
+
+// SessionRoutes lets a user see and sign out the devices they're logged in on
+func SessionRoutes() chi.Router {
+    r := chi.NewRouter()
+
+    r.Get("/", Sessions)
+    r.Delete("/", RevokeOtherSessionsHandler)
+    r.Delete("/{id}", RevokeSessionHandler)
+
+    return r
+}
+
+// EmailRoutes let a user change their email address
+func EmailRoutes() chi.Router {
+    r := chi.NewRouter()
+
+    r.With(RequireRecentAuth(ReauthMaxAge)).Post("/", ChangeEmailHandler)
+
+    return r
+}
+
+// APIKeyRoutes manage a user's API keys
+func APIKeyRoutes() chi.Router {
+    r := chi.NewRouter()
+
+    r.Get("/", APIKeys)
+    r.Delete("/{id}", DeleteAPIKeyHandler)
+
+    // Minting a credential is as sensitive as changing how you log in
+    r.With(RequireRecentAuth(ReauthMaxAge)).Post("/", CreateAPIKeyHandler)
+
+    return r
+}
+
+// AdminRoutes are account management endpoints for administrators. They
+// must be mounted behind Middleware and RequirePermission(PermAdminAccess).
+func AdminRoutes() chi.Router {
+    r := chi.NewRouter()
+
+    r.With(RequirePermission(PermUsersManage)).Put("/users/{id}/roles", UpdateUserRoles)
+    r.With(RequirePermission(PermUsersImpersonate), RequireRecentAuth(ReauthMaxAge)).
+        Post("/users/{id}/impersonate", ImpersonateHandler)
+
+    return r
+}
+
 func Register(w http.ResponseWriter, r *http.Request) {
     var req RegisterRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -66,7 +236,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    user, tokens, err := CreateUser(req.Email, req.Password, req.Name)
+    user, tokens, err := CreateUser(req.Email, req.Password, req.Name, clientInfo(r))
     if err != nil {
         if err == ErrUserExists {
             util.WriteError(w, http.StatusConflict, "User already exists")
@@ -76,6 +246,12 @@ func Register(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // The account is usable right away, so a mail failure shouldn't fail sign-up.
+    // The user can ask for another link.
+    if err := SendVerificationEmail(r.Context(), user); err != nil {
+        log.Printf("Failed to send verification email to %s: %v\n", user.ID, err)
+    }
+
     util.WriteJSON(w, http.StatusCreated, AuthResponse{User: user, Tokens: tokens})
 }
 
@@ -86,17 +262,36 @@ func Login(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    user, tokens, err := AuthenticateUser(req.Email, req.Password)
+    user, result, err := AuthenticateUser(req.Email, req.Password, clientInfo(r))
     if err != nil {
         if err == ErrInvalidCredentials {
+            auditLoginFailure(r, "password", "invalid_credentials", map[string]interface{}{"email": req.Email})
             util.WriteError(w, http.StatusUnauthorized, "Invalid email or password")
             return
         }
+        var lockout *LockoutError
+        if errors.As(err, &lockout) {
+            auditLoginFailure(r, "password", "locked_out", map[string]interface{}{"email": req.Email})
+            writeLockout(w, lockout, "Too many failed login attempts. Try again later")
+            return
+        }
         util.WriteError(w, http.StatusInternalServerError, "Failed to authenticate")
         return
     }
 
-    util.WriteJSON(w, http.StatusOK, AuthResponse{User: user, Tokens: tokens})
+    auditLogin(r, user.ID, "password", result)
+    writeLoginResult(w, user, result)
+}
+
+// writeLoginResult responds to a first-factor login with either tokens or
+// the MFA challenge the client must complete at /mfa/verify
+func writeLoginResult(w http.ResponseWriter, user *models.User, result *LoginResult) {
+    if result.MFAToken != "" {
+        util.WriteJSON(w, http.StatusOK, MFAChallengeResponse{MFARequired: true, MFAToken: result.MFAToken})
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, AuthResponse{User: user, Tokens: result.Tokens})
 }
 
 func Refresh(w http.ResponseWriter, r *http.Request) {
@@ -106,15 +301,180 @@ func Refresh(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    tokens, err := RefreshTokens(req.RefreshToken)
+    tokens, err := RefreshTokens(req.RefreshToken, clientInfo(r))
     if err != nil {
+        // A replayed token means it leaked; the whole session was just revoked
+        if err == ErrTokenReused {
+            if presented, err := ValidateToken(req.RefreshToken, TokenTypeRefresh); err == nil {
+                Audit(r, audit.Entry{
+                    Action:     audit.TokenReused,
+                    ActorID:    &presented.UserID,
+                    TargetType: audit.TargetUser,
+                    TargetID:   presented.UserID.String(),
+                    Metadata:   map[string]interface{}{"session_id": presented.SessionID.String()},
+                })
+            }
+        }
         util.WriteError(w, http.StatusUnauthorized, "Invalid refresh token")
         return
     }
 
+    if claims, err := ValidateToken(tokens.AccessToken, TokenTypeAccess); err == nil {
+        Audit(r, audit.Entry{
+            Action:     audit.TokenRefreshed,
+            ActorID:    &claims.UserID,
+            TargetType: audit.TargetUser,
+            TargetID:   claims.UserID.String(),
+            Metadata:   map[string]interface{}{"session_id": claims.SessionID.String()},
+        })
+    }
+
+    util.WriteJSON(w, http.StatusOK, tokens)
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+    var req RefreshRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if err := RevokeRefreshToken(req.RefreshToken); err != nil {
+        if err == ErrTokenNotFound {
+            util.WriteError(w, http.StatusUnauthorized, "Invalid refresh token")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to log out")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+    var req VerifyEmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    user, err := ConfirmEmail(req.Token)
+    if err != nil {
+        if err == ErrInvalidVerificationToken {
+            util.WriteError(w, http.StatusBadRequest, "Invalid or expired verification link")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to verify email")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, user)
+}
+
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+    var req EmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if err := ResendVerificationEmail(r.Context(), req.Email); err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to send verification email")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "If that account needs verifying, we've sent a new link"})
+}
+
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+    var req EmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if err := RequestPasswordReset(r.Context(), req.Email); err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to send reset email")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "If an account exists for that email, we've sent a reset link"})
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+    var req ResetPasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if msg := validatePassword(req.Password); msg != "" {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error": "Validation failed",
+            "fields": map[string]string{"password": msg},
+        })
+        return
+    }
+
+    if err := ResetPassword(req.Token, req.Password); err != nil {
+        if err == ErrInvalidVerificationToken {
+            util.WriteError(w, http.StatusBadRequest, "Invalid or expired reset link")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to reset password")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Password reset. Please log in again"})
+}
+
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    var req ChangePasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if msg := validatePassword(req.NewPassword); msg != "" {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error": "Validation failed",
+            "fields": map[string]string{"new_password": msg},
+        })
+        return
+    }
+
+    tokens, err := ChangePassword(claims.UserID, req.CurrentPassword, req.NewPassword, clientInfo(r))
+    if err != nil {
+        if err == ErrWrongPassword {
+            util.WriteError(w, http.StatusUnauthorized, "Current password is incorrect")
+            return
+        }
+        var lockout *LockoutError
+        if errors.As(err, &lockout) {
+            writeLockout(w, lockout, "Too many incorrect passwords. Try again later")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to change password")
+        return
+    }
+
     util.WriteJSON(w, http.StatusOK, tokens)
 }
 
+// OAuthNonce starts an external login by issuing the nonce the provider's ID
+// token has to carry
+func OAuthNonce(w http.ResponseWriter, r *http.Request) {
+    nonce, err := IssueOAuthNonce()
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to start login")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"nonce": nonce})
+}
+
 func OAuth(w http.ResponseWriter, r *http.Request) {
     var req OAuthRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -122,11 +482,505 @@ func OAuth(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    user, tokens, err := FindOrCreateOAuthUser(req.Provider, req.Email, req.Name, req.AvatarURL)
+    identity, err := VerifyExternalLogin(r.Context(), req.Provider, req.IDToken, req.Code, req.CodeVerifier, req.Nonce)
+    if err != nil {
+        if err == ErrUnknownProvider {
+            util.WriteError(w, http.StatusBadRequest, "Unsupported provider")
+            return
+        }
+        util.WriteError(w, http.StatusUnauthorized, "Invalid identity token")
+        return
+    }
+
+    user, result, err := FindOrCreateOAuthUser(identity, clientInfo(r))
     if err != nil {
+        if err == ErrEmailNotVerified {
+            util.WriteError(w, http.StatusForbidden, "Email not verified by provider")
+            return
+        }
+        if err == ErrAccountExists {
+            util.WriteError(w, http.StatusConflict, "An account with this email already exists. Sign in and link this provider from your account settings")
+            return
+        }
         util.WriteError(w, http.StatusInternalServerError, "Failed to authenticate")
         return
     }
 
+    auditLogin(r, user.ID, "oauth:"+identity.Provider, result)
+    writeLoginResult(w, user, result)
+}
+
+func Identities(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    identities, err := ListIdentities(claims.UserID)
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to load identities")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, identities)
+}
+
+func Link(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    var req OAuthRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    external, err := VerifyExternalLogin(r.Context(), req.Provider, req.IDToken, req.Code, req.CodeVerifier, req.Nonce)
+    if err != nil {
+        if err == ErrUnknownProvider {
+            util.WriteError(w, http.StatusBadRequest, "Unsupported provider")
+            return
+        }
+        util.WriteError(w, http.StatusUnauthorized, "Invalid identity token")
+        return
+    }
+
+    identity, err := LinkIdentity(claims.UserID, external)
+    if err != nil {
+        if err == ErrIdentityLinked {
+            util.WriteError(w, http.StatusConflict, "This login is already linked to another account")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to link identity")
+        return
+    }
+
+    Audit(r, audit.Entry{
+        Action:     audit.IdentityLinked,
+        TargetType: audit.TargetIdentity,
+        TargetID:   identity.ID.String(),
+        Metadata:   map[string]interface{}{"provider": identity.Provider},
+    })
+
+    util.WriteJSON(w, http.StatusCreated, identity)
+}
+
+func Unlink(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    id, err := uuid.Parse(chi.URLParam(r, "id"))
+    if err != nil {
+        util.WriteError(w, http.StatusNotFound, "Identity not found")
+        return
+    }
+
+    if err := UnlinkIdentity(claims.UserID, id); err != nil {
+        switch err {
+        case ErrIdentityNotFound:
+            util.WriteError(w, http.StatusNotFound, "Identity not found")
+        case ErrLastLoginMethod:
+            util.WriteError(w, http.StatusConflict, "Cannot remove your only login method")
+        default:
+            util.WriteError(w, http.StatusInternalServerError, "Failed to unlink identity")
+        }
+        return
+    }
+
+    Audit(r, audit.Entry{
+        Action:     audit.IdentityUnlinked,
+        TargetType: audit.TargetIdentity,
+        TargetID:   id.String(),
+    })
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Identity unlinked"})
+}
+
+func VerifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+    var req MFAVerifyRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    user, tokens, err := VerifyMFA(req.MFAToken, req.Code, clientInfo(r))
+    if err != nil {
+        switch err {
+        case ErrInvalidMFACode:
+            auditLoginFailure(r, "mfa", "invalid_code", nil)
+            util.WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+        case ErrInvalidMFAChallenge, ErrMFANotEnrolled:
+            util.WriteError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+        default:
+            var lockout *LockoutError
+            if errors.As(err, &lockout) {
+                auditLoginFailure(r, "mfa", "locked_out", nil)
+                writeLockout(w, lockout, "Too many failed two-factor attempts. Try again later")
+                return
+            }
+            util.WriteError(w, http.StatusInternalServerError, "Failed to authenticate")
+        }
+        return
+    }
+
+    auditLogin(r, user.ID, "mfa", nil)
     util.WriteJSON(w, http.StatusOK, AuthResponse{User: user, Tokens: tokens})
-}
\ No newline at end of file
+}
+
+func EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    secret, uri, err := EnrollTOTP(claims.UserID)
+    if err != nil {
+        if err == ErrMFAAlreadyEnabled {
+            util.WriteError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to start two-factor setup")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, TOTPEnrollmentResponse{Secret: secret, OTPAuthURI: uri})
+}
+
+func ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    var req MFACodeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    codes, err := ConfirmTOTP(claims.UserID, req.Code)
+    if err != nil {
+        switch err {
+        case ErrMFANotEnrolled:
+            util.WriteError(w, http.StatusNotFound, "No two-factor setup in progress")
+        case ErrInvalidMFACode:
+            util.WriteError(w, http.StatusBadRequest, "Invalid two-factor code")
+        default:
+            util.WriteError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+        }
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+func DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    var req MFACodeRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if err := DisableTOTP(claims.UserID, req.Code); err != nil {
+        switch err {
+        case ErrMFANotEnrolled:
+            util.WriteError(w, http.StatusNotFound, "Two-factor authentication is not enabled")
+        case ErrInvalidMFACode:
+            util.WriteError(w, http.StatusBadRequest, "Invalid two-factor code")
+        default:
+            var lockout *LockoutError
+            if errors.As(err, &lockout) {
+                writeLockout(w, lockout, "Too many failed two-factor attempts. Try again later")
+                return
+            }
+            util.WriteError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+        }
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// writeLockout tells a locked out client how long to wait before trying again
+func writeLockout(w http.ResponseWriter, lockout *LockoutError, message string) {
+    w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Seconds())+1))
+    util.WriteError(w, http.StatusTooManyRequests, message)
+}
+
+func Sessions(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    sessions, err := ListSessions(claims.UserID)
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to load sessions")
+        return
+    }
+
+    response := make([]SessionResponse, len(sessions))
+    for i, session := range sessions {
+        response[i] = SessionResponse{Session: session, Current: session.ID == claims.SessionID}
+    }
+
+    util.WriteJSON(w, http.StatusOK, response)
+}
+
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    id, err := uuid.Parse(chi.URLParam(r, "id"))
+    if err != nil {
+        util.WriteError(w, http.StatusNotFound, "Session not found")
+        return
+    }
+
+    if err := RevokeSession(claims.UserID, id); err != nil {
+        if err == ErrSessionNotFound {
+            util.WriteError(w, http.StatusNotFound, "Session not found")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to revoke session")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// RevokeOtherSessionsHandler signs out every session but the one making the request
+func RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    if err := RevokeOtherSessions(claims.UserID, claims.SessionID); err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Signed out of all other sessions"})
+}
+
+func UpdateUserRoles(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    id, err := uuid.Parse(chi.URLParam(r, "id"))
+    if err != nil {
+        util.WriteError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    var req UpdateRolesRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    previous, err := roleStore.Roles(id)
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to update roles")
+        return
+    }
+
+    roles, err := SetUserRoles(claims.UserID, id, req.Roles)
+    if err != nil {
+        switch {
+        case errors.Is(err, ErrUnknownRole):
+            util.WriteError(w, http.StatusBadRequest, "Unknown role")
+        case errors.Is(err, ErrCannotDemoteSelf):
+            util.WriteError(w, http.StatusConflict, "You cannot remove your own admin role")
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            util.WriteError(w, http.StatusNotFound, "User not found")
+        default:
+            util.WriteError(w, http.StatusInternalServerError, "Failed to update roles")
+        }
+        return
+    }
+
+    Audit(r, audit.Entry{
+        Action:     audit.RolesChanged,
+        TargetType: audit.TargetUser,
+        TargetID:   id.String(),
+        Metadata:   map[string]interface{}{"from": previous, "to": roles},
+    })
+
+    util.WriteJSON(w, http.StatusOK, map[string]interface{}{"roles": roles})
+}
+
+func ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    id, err := uuid.Parse(chi.URLParam(r, "id"))
+    if err != nil {
+        util.WriteError(w, http.StatusNotFound, "User not found")
+        return
+    }
+
+    impersonation, err := Impersonate(claims, id)
+    if err != nil {
+        switch {
+        case errors.Is(err, ErrCannotImpersonateSelf):
+            util.WriteError(w, http.StatusBadRequest, "You cannot impersonate yourself")
+        case errors.Is(err, ErrCannotImpersonateAdmin), errors.Is(err, ErrAlreadyImpersonating):
+            AuditDenied(r, audit.TargetUser, id.String(), err.Error())
+            util.WriteError(w, http.StatusForbidden, "This user cannot be impersonated")
+        case errors.Is(err, gorm.ErrRecordNotFound):
+            util.WriteError(w, http.StatusNotFound, "User not found")
+        default:
+            util.WriteError(w, http.StatusInternalServerError, "Failed to impersonate user")
+        }
+        return
+    }
+
+    Audit(r, audit.Entry{
+        Action:     audit.ImpersonationStarted,
+        TargetType: audit.TargetUser,
+        TargetID:   id.String(),
+        Metadata:   map[string]interface{}{"expires_at": impersonation.ExpiresAt},
+    })
+
+    util.WriteJSON(w, http.StatusCreated, ImpersonationResponse{
+        Impersonation: impersonation,
+        Impersonating: true,
+        UserID:        id,
+    })
+}
+
+func APIKeys(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    keys, err := ListAPIKeys(claims.UserID)
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to load API keys")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, keys)
+}
+
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    var req CreateAPIKeyRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if errs := validateCreateAPIKey(req); len(errs) > 0 {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error":  "Validation failed",
+            "fields": errs,
+        })
+        return
+    }
+
+    key, secret, err := CreateAPIKey(claims.UserID, req)
+    if err != nil {
+        if err == ErrScopeNotGranted {
+            util.WriteError(w, http.StatusForbidden, "Your roles don't grant one of those scopes")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to create API key")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusCreated, CreateAPIKeyResponse{APIKey: *key, Key: secret})
+}
+
+func DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    id, err := uuid.Parse(chi.URLParam(r, "id"))
+    if err != nil {
+        util.WriteError(w, http.StatusNotFound, "API key not found")
+        return
+    }
+
+    if err := DeleteAPIKey(claims.UserID, id); err != nil {
+        if err == ErrAPIKeyNotFound {
+            util.WriteError(w, http.StatusNotFound, "API key not found")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to delete API key")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "API key deleted"})
+}
+
+func MagicLink(w http.ResponseWriter, r *http.Request) {
+    var req EmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if err := RequestMagicLink(r.Context(), req.Email); err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to send login link")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, map[string]string{"message": "If an account exists for that email, we've sent a login link"})
+}
+
+func VerifyMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+    var req VerifyEmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    user, result, err := VerifyMagicLink(req.Token, clientInfo(r))
+    if err != nil {
+        if err == ErrInvalidVerificationToken {
+            auditLoginFailure(r, "magic_link", "invalid_token", nil)
+            util.WriteError(w, http.StatusBadRequest, "Invalid or expired login link")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to log in")
+        return
+    }
+
+    auditLogin(r, user.ID, "magic_link", result)
+    writeLoginResult(w, user, result)
+}
+
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+    claims := GetUserFromContext(r.Context())
+
+    var req EmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    if err := RequestEmailChange(r.Context(), claims.UserID, req.Email); err != nil {
+        switch err {
+        case ErrInvalidEmail:
+            util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+                "error":  "Validation failed",
+                "fields": map[string]string{"email": "Invalid email format"},
+            })
+        case ErrSameEmail:
+            util.WriteError(w, http.StatusBadRequest, "That is already your email")
+        case ErrUserExists:
+            util.WriteError(w, http.StatusConflict, "Email already in use")
+        default:
+            util.WriteError(w, http.StatusInternalServerError, "Failed to change email")
+        }
+        return
+    }
+
+    util.WriteJSON(w, http.StatusAccepted, map[string]string{"message": "Check your new email for a confirmation link"})
+}
+
+func ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+    var req VerifyEmailRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+        return
+    }
+
+    user, err := ConfirmEmailChange(req.Token)
+    if err != nil {
+        switch err {
+        case ErrInvalidVerificationToken:
+            util.WriteError(w, http.StatusBadRequest, "Invalid or expired confirmation link")
+        case ErrUserExists:
+            util.WriteError(w, http.StatusConflict, "Email already in use")
+        default:
+            util.WriteError(w, http.StatusInternalServerError, "Failed to change email")
+        }
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, user)
+}
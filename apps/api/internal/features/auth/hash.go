@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// argon2idPrefix starts every Argon2id hash. Hashes use the PHC string
+// format, so the algorithm, its version and the cost all travel with the
+// hash: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+const argon2idPrefix = "$argon2id$"
+
+// PasswordParams is the Argon2id cost new password hashes are made with
+type PasswordParams struct {
+	// Memory is in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+const (
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+)
+
+// DefaultPasswordParams follows the OWASP recommendation with extra memory
+var DefaultPasswordParams = PasswordParams{Memory: 64 * 1024, Time: 3, Threads: 2}
+
+var passwordParams = DefaultPasswordParams
+
+// LoadPasswordParams reads the Argon2id cost from PASSWORD_ARGON2_MEMORY_KIB,
+// PASSWORD_ARGON2_TIME and PASSWORD_ARGON2_THREADS. Unset values keep their
+// defaults. Raising any of them upgrades each user's hash at their next login.
+func LoadPasswordParams() error {
+	params, err := parsePasswordParams(os.Getenv)
+	if err != nil {
+		return err
+	}
+	passwordParams = params
+	return nil
+}
+
+func parsePasswordParams(getenv func(string) string) (PasswordParams, error) {
+	params := DefaultPasswordParams
+
+	settings := []struct {
+		name string
+		min  uint64
+		max  uint64
+		set  func(uint64)
+	}{
+		{"PASSWORD_ARGON2_MEMORY_KIB", 8 * 1024, 4 * 1024 * 1024, func(v uint64) { params.Memory = uint32(v) }},
+		{"PASSWORD_ARGON2_TIME", 1, 100, func(v uint64) { params.Time = uint32(v) }},
+		{"PASSWORD_ARGON2_THREADS", 1, 255, func(v uint64) { params.Threads = uint8(v) }},
+	}
+
+	for _, setting := range settings {
+		raw := getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || v < setting.min || v > setting.max {
+			return PasswordParams{}, fmt.Errorf("%s must be between %d and %d", setting.name, setting.min, setting.max)
+		}
+		setting.set(v)
+	}
+
+	return params, nil
+}
+
+// SetPasswordParams replaces the cost used for new password hashes
+func SetPasswordParams(params PasswordParams) {
+	passwordParams = params
+}
+
+func hashArgon2id(password string, params PasswordParams) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, passwordKeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// parseArgon2id splits an Argon2id hash into its cost, salt and key
+func parseArgon2id(hash string) (PasswordParams, []byte, []byte, error) {
+	var params PasswordParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, key, nil
+}
+
+func checkArgon2id(password, hash string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	got := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
+
+// NeedsRehash reports whether a hash was made with an older algorithm or a
+// different cost than new hashes get
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return true
+	}
+
+	params, _, key, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params != passwordParams || len(key) != passwordKeyLength
+}
+
+func checkBcrypt(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
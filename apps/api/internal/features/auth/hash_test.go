@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword_Argon2idFormat(t *testing.T) {
+	hash, err := HashPassword("SecurePass123")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Errorf("hash = %q, want the argon2id format with the configured cost", hash)
+	}
+	if NeedsRehash(hash) {
+		t.Error("a fresh hash should not need rehashing")
+	}
+}
+
+func TestCheckPassword_LegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("SecurePass123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !CheckPassword("SecurePass123", string(legacy)) {
+		t.Error("bcrypt hashes should still verify")
+	}
+	if CheckPassword("WrongPass123", string(legacy)) {
+		t.Error("wrong password should not verify against a bcrypt hash")
+	}
+}
+
+func TestCheckPassword_MalformedArgon2id(t *testing.T) {
+	tests := []string{
+		"$argon2id$",
+		"$argon2id$v=19$m=8192,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=8192,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8192,t=1,p=1$!!!$a2V5",
+	}
+
+	for _, hash := range tests {
+		if CheckPassword("anything", hash) {
+			t.Errorf("CheckPassword accepted malformed hash %q", hash)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current, _ := hashArgon2id("SecurePass123", passwordParams)
+	weaker, _ := hashArgon2id("SecurePass123", PasswordParams{Memory: passwordParams.Memory, Time: passwordParams.Time, Threads: 2})
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("SecurePass123"), bcrypt.MinCost)
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{name: "current cost", hash: current, want: false},
+		{name: "different cost", hash: weaker, want: true},
+		{name: "bcrypt", hash: string(legacy), want: true},
+		{name: "malformed", hash: "$argon2id$nope", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePasswordParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    PasswordParams
+		wantErr bool
+	}{
+		{name: "defaults", env: map[string]string{}, want: DefaultPasswordParams},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"PASSWORD_ARGON2_MEMORY_KIB": "131072",
+				"PASSWORD_ARGON2_TIME":       "4",
+				"PASSWORD_ARGON2_THREADS":    "1",
+			},
+			want: PasswordParams{Memory: 131072, Time: 4, Threads: 1},
+		},
+		{name: "memory too low", env: map[string]string{"PASSWORD_ARGON2_MEMORY_KIB": "1024"}, wantErr: true},
+		{name: "zero time", env: map[string]string{"PASSWORD_ARGON2_TIME": "0"}, wantErr: true},
+		{name: "not a number", env: map[string]string{"PASSWORD_ARGON2_THREADS": "many"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePasswordParams(func(name string) string { return tt.env[name] })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePasswordParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parsePasswordParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
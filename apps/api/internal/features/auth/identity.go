@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAccountExists    = errors.New("an account with this email already exists")
+	ErrIdentityLinked   = errors.New("identity already linked to an account")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrLastLoginMethod  = errors.New("cannot remove the last login method")
+)
+
+// ListIdentities returns every login method linked to a user
+func ListIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+// findIdentity looks up the identity for a provider's subject
+func findIdentity(db *gorm.DB, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// emailIdentity builds the identity backing a password login
+func emailIdentity(userID uuid.UUID, email string) *models.UserIdentity {
+	return &models.UserIdentity{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Provider: models.IdentityProviderEmail,
+		Subject:  strings.ToLower(email),
+		Email:    email,
+	}
+}
+
+// LinkIdentity attaches a verified external identity to an existing user
+func LinkIdentity(userID uuid.UUID, external *ExternalIdentity) (*models.UserIdentity, error) {
+	existing, err := findIdentity(database.DB, external.Provider, external.Subject)
+	if err == nil {
+		if existing.UserID == userID {
+			return existing, nil
+		}
+		return nil, ErrIdentityLinked
+	}
+	if err != ErrIdentityNotFound {
+		return nil, err
+	}
+
+	identity := &models.UserIdentity{
+		ID:       uuid.New(),
+		UserID:   userID,
+		Provider: external.Provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+
+	if err := database.DB.Create(identity).Error; err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// UnlinkIdentity removes a login method from a user. The last remaining
+// method can't be removed, since the account would become unreachable.
+func UnlinkIdentity(userID, identityID uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the user row so two concurrent unlinks can't both pass the count check
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		var identity models.UserIdentity
+		err := tx.Where("id = ? AND user_id = ?", identityID, userID).First(&identity).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrIdentityNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastLoginMethod
+		}
+
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+
+		// Without its email identity the password must stop working too
+		if identity.Provider == models.IdentityProviderEmail {
+			return tx.Model(&user).Update("password_hash", nil).Error
+		}
+
+		return nil
+	})
+}
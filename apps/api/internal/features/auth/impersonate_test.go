@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// impersonate signs an admin in and returns their claims with a token
+// acting as hostID
+func impersonate(t *testing.T, hostID uuid.UUID) (*Claims, *Claims, string) {
+	t.Helper()
+
+	store := roleStore.(memoryRoleStore)
+	adminID := uuid.New()
+	store[adminID] = []models.Role{models.RoleAdmin}
+	t.Cleanup(func() { delete(store, adminID) })
+
+	admin := accessClaims(t, mustGenerateTokens(t, adminID))
+	impersonation, err := impersonationToken(admin, hostID)
+	if err != nil {
+		t.Fatalf("impersonationToken failed: %v", err)
+	}
+
+	claims, err := ValidateToken(impersonation.AccessToken, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	return admin, claims, impersonation.AccessToken
+}
+
+func TestImpersonationToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	hostID := uuid.New()
+	admin, claims, _ := impersonate(t, hostID)
+
+	if claims.UserID != hostID {
+		t.Errorf("UserID = %v, want the impersonated user", claims.UserID)
+	}
+	if !claims.Impersonating() || claims.Actor.UserID != admin.UserID {
+		t.Errorf("Actor = %+v, want the admin", claims.Actor)
+	}
+	if !slices.Equal(claims.Roles, models.DefaultRoles) {
+		t.Errorf("Roles = %v, want the impersonated user's", claims.Roles)
+	}
+	if claims.AuthTime != nil {
+		t.Error("impersonation tokens should never count as a recent login")
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) != impersonationTTL {
+		t.Errorf("lifetime = %v, want %v", claims.ExpiresAt.Sub(claims.IssuedAt.Time), impersonationTTL)
+	}
+}
+
+func TestImpersonationToken_EndsWithAdminSession(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	admin, claims, _ := impersonate(t, uuid.New())
+
+	if active, _ := sessionActive(claims); !active {
+		t.Fatal("impersonation should be active while the admin is signed in")
+	}
+
+	if err := SignOutEverywhere(admin.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := sessionActive(claims); active {
+		t.Error("signing the admin out should end the impersonation")
+	}
+}
+
+func TestImpersonate_Rejects(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	store := roleStore.(memoryRoleStore)
+	otherAdmin := uuid.New()
+	store[otherAdmin] = []models.Role{models.RoleAdmin}
+	defer delete(store, otherAdmin)
+
+	admin := &Claims{UserID: uuid.New(), Roles: []models.Role{models.RoleAdmin}}
+	nested := &Claims{UserID: uuid.New(), Actor: &Actor{UserID: admin.UserID}}
+
+	if _, err := Impersonate(admin, admin.UserID); err != ErrCannotImpersonateSelf {
+		t.Errorf("self: error = %v, want ErrCannotImpersonateSelf", err)
+	}
+	if _, err := Impersonate(nested, uuid.New()); err != ErrAlreadyImpersonating {
+		t.Errorf("nested: error = %v, want ErrAlreadyImpersonating", err)
+	}
+	if _, err := impersonationToken(admin, otherAdmin); err != ErrCannotImpersonateAdmin {
+		t.Errorf("admin target: error = %v, want ErrCannotImpersonateAdmin", err)
+	}
+}
+
+func TestMiddleware_Impersonation(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	hostID := uuid.New()
+	admin, _, token := impersonate(t, hostID)
+
+	tests := []struct {
+		method     string
+		wantStatus int
+		wantAction audit.Action
+	}{
+		{method: http.MethodGet, wantStatus: http.StatusOK, wantAction: audit.ImpersonatedRequest},
+		{method: http.MethodPut, wantStatus: http.StatusForbidden, wantAction: audit.PermissionDenied},
+		{method: http.MethodDelete, wantStatus: http.StatusForbidden, wantAction: audit.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(tt.method, "/spots/1", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get(ImpersonatorHeader); got != admin.UserID.String() {
+				t.Errorf("%s = %q, want the admin's ID", ImpersonatorHeader, got)
+			}
+
+			event := auditEvents.last(tt.wantAction)
+			if event == nil || event.ImpersonatorID == nil || *event.ImpersonatorID != admin.UserID {
+				t.Fatalf("expected a %s event naming the admin", tt.wantAction)
+			}
+			if event.ActorID == nil || *event.ActorID != hostID {
+				t.Errorf("actor = %v, want the impersonated user", event.ActorID)
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuth_RejectsImpersonation(t *testing.T) {
+	handler := RequireRecentAuth(ReauthMaxAge)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	claims := &Claims{UserID: uuid.New(), Actor: &Actor{UserID: uuid.New()}}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), UserContextKey, claims))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
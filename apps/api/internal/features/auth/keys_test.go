@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writeKey(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+func writeRSAKey(t *testing.T, dir, kid string) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	writeKey(t, dir, kid, "PRIVATE KEY", der)
+	return key
+}
+
+func writeEd25519Key(t *testing.T, dir, kid string) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	writeKey(t, dir, kid, "PRIVATE KEY", der)
+	return key
+}
+
+func useKeySet(t *testing.T, dir, activeKID string) {
+	t.Helper()
+	ks, err := LoadKeySet(dir, activeKID)
+	if err != nil {
+		t.Fatalf("LoadKeySet failed: %v", err)
+	}
+	SetKeySet(ks)
+	t.Cleanup(func() { SetKeySet(nil) })
+}
+
+func TestKeySet_SignsWithKID(t *testing.T) {
+	tests := []struct {
+		name    string
+		write   func(t *testing.T, dir, kid string)
+		wantAlg string
+	}{
+		{
+			name:    "RS256",
+			write:   func(t *testing.T, dir, kid string) { writeRSAKey(t, dir, kid) },
+			wantAlg: "RS256",
+		},
+		{
+			name:    "EdDSA",
+			write:   func(t *testing.T, dir, kid string) { writeEd25519Key(t, dir, kid) },
+			wantAlg: "EdDSA",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.write(t, dir, "2026-01")
+			useKeySet(t, dir, "")
+
+			userID := uuid.New()
+			tokens, err := GenerateTokens(userID, ClientInfo{})
+			if err != nil {
+				t.Fatalf("GenerateTokens failed: %v", err)
+			}
+
+			parsed, _, _ := jwt.NewParser().ParseUnverified(tokens.AccessToken, &Claims{})
+			if parsed.Header["kid"] != "2026-01" {
+				t.Errorf("kid = %v, want 2026-01", parsed.Header["kid"])
+			}
+			if parsed.Method.Alg() != tt.wantAlg {
+				t.Errorf("alg = %v, want %v", parsed.Method.Alg(), tt.wantAlg)
+			}
+
+			claims, err := ValidateToken(tokens.AccessToken, TokenTypeAccess)
+			if err != nil {
+				t.Fatalf("ValidateToken failed: %v", err)
+			}
+			if claims.UserID != userID {
+				t.Errorf("UserID mismatch: got %v, want %v", claims.UserID, userID)
+			}
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeRSAKey(t, dir, "2026-01")
+	useKeySet(t, dir, "")
+
+	oldTokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+
+	// Rotate: add a newer key and retire the old one to its public half
+	writeEd25519Key(t, dir, "2026-02")
+	pub, _ := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	writeKey(t, dir, "2026-01", "PUBLIC KEY", pub)
+	useKeySet(t, dir, "")
+
+	if _, err := ValidateToken(oldTokens.AccessToken, TokenTypeAccess); err != nil {
+		t.Errorf("Token signed with retired key should still validate: %v", err)
+	}
+
+	newTokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newTokens.AccessToken, &Claims{})
+	if parsed.Header["kid"] != "2026-02" {
+		t.Errorf("New tokens should be signed with newest key, got kid %v", parsed.Header["kid"])
+	}
+}
+
+func TestKeySet_RejectsUnknownKID(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2026-01")
+	useKeySet(t, dir, "")
+	tokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+
+	otherDir := t.TempDir()
+	writeRSAKey(t, otherDir, "2026-03")
+	useKeySet(t, otherDir, "")
+
+	if _, err := ValidateToken(tokens.AccessToken, TokenTypeAccess); err == nil {
+		t.Error("ValidateToken should reject tokens signed with a key not in the set")
+	}
+}
+
+func TestKeySet_LegacySecret(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	legacy, _ := GenerateTokens(uuid.New(), ClientInfo{})
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2026-01")
+	useKeySet(t, dir, "")
+
+	if _, err := ValidateToken(legacy.AccessToken, TokenTypeAccess); err != nil {
+		t.Errorf("HS256 token should validate while JWT_SECRET is set: %v", err)
+	}
+
+	os.Unsetenv("JWT_SECRET")
+	if _, err := ValidateToken(legacy.AccessToken, TokenTypeAccess); err == nil {
+		t.Error("HS256 token should be rejected once JWT_SECRET is removed")
+	}
+}
+
+func TestLoadKeySet_NoPrivateKey(t *testing.T) {
+	dir := t.TempDir()
+	key := writeRSAKey(t, dir, "2026-01")
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	writeKey(t, dir, "2026-01", "PUBLIC KEY", pub)
+
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Error("LoadKeySet should fail without a key that can sign")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := writeRSAKey(t, dir, "2026-01")
+	writeEd25519Key(t, dir, "2026-02")
+	useKeySet(t, dir, "")
+
+	jwks := keySet.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(jwks.Keys))
+	}
+
+	if jwks.Keys[0].KeyType != "RSA" || jwks.Keys[1].KeyType != "OKP" {
+		t.Errorf("Unexpected key types: %+v", jwks.Keys)
+	}
+
+	// A verifier should be able to rebuild the RSA key from the JWK alone
+	n, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	rebuilt := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if !rebuilt.Equal(&rsaKey.PublicKey) {
+		t.Error("JWK does not match RSA public key")
+	}
+
+	if got := (*KeySet)(nil).JWKS(); len(got.Keys) != 0 {
+		t.Error("JWKS without a key set should be empty")
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/mail"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"gorm.io/gorm"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// RequestMagicLink emails a single-use login link. Like password resets,
+// unknown addresses succeed silently.
+func RequestMagicLink(ctx context.Context, email string) error {
+	var user models.User
+	err := database.DB.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	secret, err := issueVerificationToken(user.ID, models.TokenPurposeMagicLink, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendLink("/auth/magic-link", url.Values{"token": {secret}})
+	return mail.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your ParkShare login link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to log in to ParkShare. It works once and expires in 15 minutes.\n\n%s\n\nIf you didn't ask to log in, you can ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// VerifyMagicLink redeems a login link. Getting the link proves the user
+// owns the address, so it's marked verified. Users with two-factor enabled
+// still get an MFA challenge rather than tokens.
+func VerifyMagicLink(secret string, client ClientInfo) (*models.User, *LoginResult, error) {
+	var user models.User
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, secret, models.TokenPurposeMagicLink)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, "id = ?", token.UserID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Update("is_verified", true).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := startLogin(user.ID, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, result, nil
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication not enrolled")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid mfa challenge")
+)
+
+const recoveryCodeCount = 10
+
+// LoginResult is what passing the first factor earns: tokens, or for users
+// with two-factor enabled, a challenge token to redeem with a code
+type LoginResult struct {
+	Tokens   *TokenPair
+	MFAToken string
+}
+
+// startLogin finishes a first-factor login
+func startLogin(userID uuid.UUID, client ClientInfo) (*LoginResult, error) {
+	enabled, err := mfaEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		challenge, err := issueMFAChallenge(userID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: challenge}, nil
+	}
+
+	tokens, err := GenerateTokens(userID, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// issueMFAChallenge signs a short-lived token proving the first factor
+// passed. Its jti is recorded so VerifyMFA can redeem it only once.
+func issueMFAChallenge(userID uuid.UUID) (string, error) {
+	claims := newClaims(userID, TokenTypeMFA, timeNow(), mfaChallengeTTL)
+	claims.ID = uuid.NewString()
+
+	if err := challengeStore.Create(claims.ID, userID, claims.ExpiresAt.Time); err != nil {
+		return "", err
+	}
+	return signToken(claims)
+}
+
+// ChallengeStore remembers issued MFA challenges so each can be used once
+type ChallengeStore interface {
+	Create(jti string, userID uuid.UUID, expiresAt time.Time) error
+	// Consume marks a challenge used. It reports false if the challenge is
+	// unknown, expired or already used, so concurrent verifies can't both
+	// succeed.
+	Consume(jti string, userID uuid.UUID, at time.Time) (bool, error)
+}
+
+var challengeStore ChallengeStore = gormChallengeStore{}
+
+// SetChallengeStore replaces the store used for MFA challenges
+func SetChallengeStore(store ChallengeStore) {
+	challengeStore = store
+}
+
+// gormChallengeStore keeps challenges as verification tokens holding the
+// hash of their jti
+type gormChallengeStore struct{}
+
+func (gormChallengeStore) Create(jti string, userID uuid.UUID, expiresAt time.Time) error {
+	return database.DB.Create(&models.VerificationToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   models.TokenPurposeMFAChallenge,
+		TokenHash: hashToken(jti),
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+func (gormChallengeStore) Consume(jti string, userID uuid.UUID, at time.Time) (bool, error) {
+	result := database.DB.Model(&models.VerificationToken{}).
+		Where("token_hash = ? AND purpose = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?",
+			hashToken(jti), models.TokenPurposeMFAChallenge, userID, at).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func mfaEnabled(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.TOTPFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// EnrollTOTP starts authenticator setup, returning the secret and an
+// otpauth:// URI for a QR code. Nothing changes for logins until the user
+// confirms with ConfirmTOTP.
+func EnrollTOTP(userID uuid.UUID) (string, string, error) {
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return "", "", err
+	}
+
+	enabled, err := mfaEnabled(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Starting over replaces any earlier unconfirmed secret
+	factor := &models.TOTPFactor{UserID: userID, Secret: secret}
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "updated_at"}),
+	}).Create(factor).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, totpURI(secret, user.Email), nil
+}
+
+// ConfirmTOTP turns on two-factor once the user shows a valid code, and
+// returns freshly generated recovery codes. They are only shown this once.
+func ConfirmTOTP(userID uuid.UUID, code string) ([]string, error) {
+	var codes []string
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var factor models.TOTPFactor
+		err := tx.Where("user_id = ? AND confirmed_at IS NULL", userID).First(&factor).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFANotEnrolled
+		}
+		if err != nil {
+			return err
+		}
+
+		step, ok := validateTOTP(factor.Secret, code, timeNow())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		now := timeNow()
+		if err := tx.Model(&factor).Updates(map[string]interface{}{
+			"confirmed_at":   now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor off. It takes a current code or recovery code
+// so a hijacked session alone can't strip the protection, and attempts count
+// towards the same lockout as VerifyMFA so the code can't be guessed.
+func DisableTOTP(userID uuid.UUID, code string) error {
+	keys := mfaThrottleKeys(userID)
+	if err := throttleAttempt(keys); err != nil {
+		return err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TOTPFactor{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return clearLoginFailures(keys)
+}
+
+// VerifyMFA completes a two-step login with an authenticator or recovery
+// code. The challenge is consumed on success, and every attempt counts
+// towards a per-user lockout until one succeeds, so codes can't be guessed
+// from many addresses.
+func VerifyMFA(challenge, code string, client ClientInfo) (*models.User, *TokenPair, error) {
+	claims, err := ValidateToken(challenge, TokenTypeMFA)
+	if err != nil || claims.ID == "" {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	keys := mfaThrottleKeys(claims.UserID)
+	if err := throttleAttempt(keys); err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, claims.UserID, code); err != nil {
+			return err
+		}
+		return tx.First(&user, "id = ?", claims.UserID).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only consumed after a correct code, so a typo doesn't cost the user
+	// their challenge
+	consumed, err := challengeStore.Consume(claims.ID, claims.UserID, timeNow())
+	if err != nil {
+		return nil, nil, err
+	}
+	if !consumed {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	if err := clearLoginFailures(keys); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := GenerateTokens(user.ID, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, tokens, nil
+}
+
+// checkSecondFactor accepts a TOTP code, or failing that an unused recovery
+// code, consuming whichever matched
+func checkSecondFactor(tx *gorm.DB, userID uuid.UUID, code string) error {
+	var factor models.TOTPFactor
+	err := tx.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&factor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMFANotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+
+	if step, ok := validateTOTP(factor.Secret, code, timeNow()); ok {
+		// Conditional on the step moving forward, so the same code can't
+		// be used twice even by concurrent requests
+		result := tx.Model(&models.TOTPFactor{}).
+			Where("user_id = ? AND last_used_step < ?", userID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", timeNow())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and generates new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: hashRecoveryCode(code)}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCode returns a random code formatted like "abcde-fghij"
+func newRecoveryCode() (string, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(secret[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case and separators so
+// users can type it however they copied it
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(normalized)
+}
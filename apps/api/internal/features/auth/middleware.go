@@ -2,21 +2,66 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
 	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/go-chi/httprate"
+	"github.com/google/uuid"
 )
 
 type contextKey string
 
 const UserContextKey contextKey = "user"
 
-// Middleware validates JWT and adds user to context
+// APIKeyHeader carries an API key in place of a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// Middleware validates an access token JWT, or an API key, and adds user to context
 func Middleware(next http.Handler) http.Handler {
+    return authenticate(next, false)
+}
+
+// OptionalMiddleware adds the user to context like Middleware when the
+// request carries credentials, and lets anonymous requests through without.
+// Credentials that are present but invalid are still rejected, so a client
+// with an expired token knows to refresh rather than silently browsing
+// signed out.
+func OptionalMiddleware(next http.Handler) http.Handler {
+    return authenticate(next, true)
+}
+
+// RequireAuth only lets through signed-in callers, for routes behind
+// OptionalMiddleware that need a user
+func RequireAuth(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if GetUserFromContext(r.Context()) == nil {
+            util.WriteError(w, http.StatusUnauthorized, "Missing authorization header")
+            return
+        }
+
+        next.ServeHTTP(w, r)
+    })
+}
+
+func authenticate(next http.Handler, optional bool) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if key := r.Header.Get(APIKeyHeader); key != "" {
+            serveAPIKey(w, r, key, next)
+            return
+        }
+
         authHeader := r.Header.Get("Authorization")
         if authHeader == "" {
+            if optional {
+                next.ServeHTTP(w, r)
+                return
+            }
             util.WriteError(w, http.StatusUnauthorized, "Missing authorization header")
             return
         }
@@ -27,15 +72,129 @@ func Middleware(next http.Handler) http.Handler {
             return
         }
 
-        claims, err := ValidateToken(parts[1])
+        claims, err := ValidateToken(parts[1], TokenTypeAccess)
         if err != nil {
             util.WriteError(w, http.StatusUnauthorized, "Invalid token")
             return
         }
 
+        // Checked on every request so signing a device out takes effect
+        // before its access token expires
+        active, err := sessionActive(claims)
+        if err != nil {
+            util.WriteError(w, http.StatusInternalServerError, "Failed to check session")
+            return
+        }
+        if !active {
+            util.WriteError(w, http.StatusUnauthorized, "Session revoked")
+            return
+        }
+
         // Add claims to context
         ctx := context.WithValue(r.Context(), UserContextKey, claims)
-        next.ServeHTTP(w, r.WithContext(ctx))
+        r = r.WithContext(ctx)
+
+        if claims.Impersonating() {
+            serveImpersonated(w, r, claims, next)
+            return
+        }
+
+        next.ServeHTTP(w, r)
+    })
+}
+
+// serveImpersonated flags and audits a request made by an admin acting as
+// another user. Impersonation is for looking, so writes are refused.
+func serveImpersonated(w http.ResponseWriter, r *http.Request, claims *Claims, next http.Handler) {
+    w.Header().Set(ImpersonatorHeader, claims.Actor.UserID.String())
+
+    if !readOnlyMethod(r.Method) {
+        AuditDenied(r, "", "", "write while impersonating")
+        util.WriteError(w, http.StatusForbidden, "Not allowed while impersonating")
+        return
+    }
+
+    Audit(r, audit.Entry{
+        Action:   audit.ImpersonatedRequest,
+        Metadata: map[string]interface{}{"method": r.Method, "path": r.URL.Path},
+    })
+
+    next.ServeHTTP(w, r)
+}
+
+// serveAPIKey authenticates an API key request and applies the key's rate limit
+func serveAPIKey(w http.ResponseWriter, r *http.Request, presented string, next http.Handler) {
+    key, claims, err := AuthenticateAPIKey(presented)
+    if err != nil {
+        if errors.Is(err, ErrInvalidAPIKey) {
+            util.WriteError(w, http.StatusUnauthorized, "Invalid API key")
+            return
+        }
+        util.WriteError(w, http.StatusInternalServerError, "Failed to check API key")
+        return
+    }
+
+    ctx := httprate.WithRequestLimit(r.Context(), key.RateLimit)
+    if apiKeyLimiter.OnLimit(w, r.WithContext(ctx), key.ID.String()) {
+        util.WriteError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+        return
+    }
+
+    ctx = context.WithValue(ctx, UserContextKey, claims)
+    next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RejectAPIKeys keeps API keys away from account management, which needs the
+// user themselves. It must run after Middleware.
+func RejectAPIKeys(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        claims := GetUserFromContext(r.Context())
+        if claims != nil && claims.APIKeyID != uuid.Nil {
+            AuditDenied(r, "", "", "api key not allowed")
+            util.WriteError(w, http.StatusForbidden, "Not available to API keys")
+            return
+        }
+
+        next.ServeHTTP(w, r)
+    })
+}
+
+// RequireRecentAuth only lets through users who logged in within maxAge, for
+// actions that a stolen session shouldn't be able to take. It must run after
+// Middleware.
+func RequireRecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            claims := GetUserFromContext(r.Context())
+            if claims == nil || claims.AuthTime == nil || timeNow().Sub(claims.AuthTime.Time) > maxAge {
+                util.WriteError(w, http.StatusUnauthorized, "Re-authentication required")
+                return
+            }
+
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// RequireVerified only lets through users who have confirmed their email. It
+// must run after Middleware.
+func RequireVerified(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        claims := GetUserFromContext(r.Context())
+        if claims == nil {
+            util.WriteError(w, http.StatusUnauthorized, "Missing authorization header")
+            return
+        }
+
+        // Looked up rather than carried in the token so verifying takes effect immediately
+        var user models.User
+        if err := database.DB.Select("is_verified").First(&user, "id = ?", claims.UserID).Error; err != nil || !user.IsVerified {
+            AuditDenied(r, "", "", "email not verified")
+            util.WriteError(w, http.StatusForbidden, "Email verification required")
+            return
+        }
+
+        next.ServeHTTP(w, r)
     })
 }
 
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestOptionalMiddleware(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	userID := uuid.New()
+	tokens, _ := GenerateTokens(userID, ClientInfo{})
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantUser   bool
+	}{
+		{name: "anonymous", header: "", wantStatus: http.StatusOK, wantUser: false},
+		{name: "valid token", header: "Bearer " + tokens.AccessToken, wantStatus: http.StatusOK, wantUser: true},
+		{name: "invalid token", header: "Bearer not-a-token", wantStatus: http.StatusUnauthorized},
+		{name: "malformed header", header: "Basic abc", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Claims
+			handler := OptionalMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetUserFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/spots/1", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if (got != nil) != tt.wantUser {
+				t.Errorf("claims = %v, want user %v", got, tt.wantUser)
+			}
+			if got != nil && got.UserID != userID {
+				t.Errorf("UserID = %v, want %v", got.UserID, userID)
+			}
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	handler := OptionalMiddleware(RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/spots", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireRecentAuth_FixedClock(t *testing.T) {
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	handler := RequireRecentAuth(ReauthMaxAge)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	claims := &Claims{UserID: uuid.New(), AuthTime: jwt.NewNumericDate(clock)}
+
+	serve := func() int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), UserContextKey, claims))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	clock = clock.Add(ReauthMaxAge - time.Minute)
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("Within the window: status = %d, want %d", code, http.StatusOK)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if code := serve(); code != http.StatusUnauthorized {
+		t.Errorf("After the window: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
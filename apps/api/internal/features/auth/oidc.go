@@ -0,0 +1,375 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidIDToken   = errors.New("invalid id token")
+	ErrEmailNotVerified = errors.New("email not verified by provider")
+)
+
+// ExternalIdentity is who an identity provider says the user is
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// OIDCProvider verifies logins from an external OpenID Connect provider
+type OIDCProvider interface {
+	// Exchange redeems an authorization code and its PKCE verifier for an ID token
+	Exchange(ctx context.Context, code, codeVerifier string) (string, error)
+	// Verify checks an ID token's signature and claims, including that it
+	// carries nonce
+	Verify(ctx context.Context, idToken, nonce string) (*ExternalIdentity, error)
+}
+
+var providers = map[string]OIDCProvider{}
+
+// RegisterProvider makes an identity provider available under name
+func RegisterProvider(name string, provider OIDCProvider) {
+	providers[name] = provider
+}
+
+// LoadProviders registers the identity providers configured in the environment
+func LoadProviders() {
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		RegisterProvider("google", NewOIDCProvider(OIDCConfig{
+			Name:         "google",
+			Issuers:      []string{"https://accounts.google.com", "accounts.google.com"},
+			JWKSURL:      "https://www.googleapis.com/oauth2/v3/certs",
+			TokenURL:     "https://oauth2.googleapis.com/token",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
+		}))
+	}
+}
+
+// oauthNonceTTL is how long a client has to finish an external login
+const oauthNonceTTL = 10 * time.Minute
+
+// NonceStore remembers the nonces issued for external logins
+type NonceStore interface {
+	Create(hash string, expiresAt time.Time) error
+	// Consume redeems a nonce. It reports false if the nonce is unknown,
+	// expired or already used.
+	Consume(hash string, at time.Time) (bool, error)
+	// Purge deletes nonces that expired before at
+	Purge(at time.Time) (int64, error)
+}
+
+var nonceStore NonceStore = gormNonceStore{}
+
+// SetNonceStore replaces the store used for external login nonces
+func SetNonceStore(store NonceStore) {
+	nonceStore = store
+}
+
+type gormNonceStore struct{}
+
+func (gormNonceStore) Create(hash string, expiresAt time.Time) error {
+	return database.DB.Create(&models.OAuthNonce{NonceHash: hash, ExpiresAt: expiresAt}).Error
+}
+
+func (gormNonceStore) Consume(hash string, at time.Time) (bool, error) {
+	result := database.DB.Where("nonce_hash = ? AND expires_at > ?", hash, at).Delete(&models.OAuthNonce{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (gormNonceStore) Purge(at time.Time) (int64, error) {
+	result := database.DB.Where("expires_at <= ?", at).Delete(&models.OAuthNonce{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeOAuthNonces deletes nonces for logins that were never finished.
+// Anyone can start a login, so left alone they'd pile up.
+func PurgeOAuthNonces(now time.Time) (int64, error) {
+	return nonceStore.Purge(now)
+}
+
+// IssueOAuthNonce starts an external login. The client passes the nonce to
+// the provider, which signs it into the ID token, and sends it back with
+// the token so the token can't be replayed outside this login.
+func IssueOAuthNonce() (string, error) {
+	nonce, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if err := nonceStore.Create(hashToken(nonce), timeNow().Add(oauthNonceTTL)); err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// VerifyExternalLogin resolves a login against the named provider. Clients
+// send either an ID token they already hold or an authorization code, plus
+// the nonce they were issued for this login.
+func VerifyExternalLogin(ctx context.Context, provider, idToken, code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	p, ok := providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	if idToken == "" && code != "" {
+		var err error
+		if idToken, err = p.Exchange(ctx, code, codeVerifier); err != nil {
+			return nil, err
+		}
+	}
+
+	if idToken == "" || nonce == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	identity, err := p.Verify(ctx, idToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redeemed last, so a bad token doesn't burn the user's nonce
+	consumed, err := nonceStore.Consume(hashToken(nonce), timeNow())
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, fmt.Errorf("%w: unknown or used nonce", ErrInvalidIDToken)
+	}
+
+	return identity, nil
+}
+
+type OIDCConfig struct {
+	Name         string
+	Issuers      []string
+	JWKSURL      string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+type oidcProvider struct {
+	config OIDCConfig
+	keys   *remoteKeySet
+	client *http.Client
+}
+
+// NewOIDCProvider returns a provider that verifies ID tokens against the
+// issuer's published JWKS
+func NewOIDCProvider(config OIDCConfig) OIDCProvider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &oidcProvider{
+		config: config,
+		keys:   &remoteKeySet{url: config.JWKSURL, client: client},
+		client: client,
+	}
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"redirect_uri":  {p.config.RedirectURL},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s token exchange failed: %s", p.config.Name, res.Status)
+	}
+
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	return body.IDToken, nil
+}
+
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+func (p *oidcProvider) Verify(ctx context.Context, idToken, nonce string) (*ExternalIdentity, error) {
+	token, err := jwt.ParseWithClaims(idToken, &idTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.get(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(*idTokenClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	// Google uses two spellings of its issuer, so the parser's single-issuer
+	// check isn't enough
+	if !slices.Contains(p.config.Issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &ExternalIdentity{
+		Provider:      p.config.Name,
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		AvatarURL:     claims.Picture,
+	}, nil
+}
+
+// jwksRefreshInterval bounds how often an unknown kid can trigger a refetch
+const jwksRefreshInterval = time.Minute
+
+// remoteKeySet caches a provider's JWKS and refetches it when a token names
+// a key we haven't seen, which is how providers roll their keys
+type remoteKeySet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func (s *remoteKeySet) get(ctx context.Context, kid string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(s.fetchedAt) < jwksRefreshInterval {
+		return nil, ErrUnknownSigningKey
+	}
+
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+	s.fetchedAt = time.Now()
+
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+func (s *remoteKeySet) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS failed: %s", res.Status)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+
+	return keys, nil
+}
+
+// publicKey decodes the key material of a JWK
+func (jwk JWK) publicKey() (interface{}, error) {
+	enc := base64.RawURLEncoding
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := enc.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := enc.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		x, err := enc.DecodeString(jwk.X)
+		if err != nil || jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+}
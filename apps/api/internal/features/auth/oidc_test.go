@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memoryNonceStore keeps external login nonces in memory
+type memoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+func (s *memoryNonceStore) Create(hash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[hash] = expiresAt
+	return nil
+}
+
+func (s *memoryNonceStore) Consume(hash string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.nonces[hash]
+	if !ok || !at.Before(expiresAt) {
+		return false, nil
+	}
+	delete(s.nonces, hash)
+	return true, nil
+}
+
+func (s *memoryNonceStore) Purge(at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for hash, expiresAt := range s.nonces {
+		if !at.Before(expiresAt) {
+			delete(s.nonces, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// testIdP is a stand-in OpenID provider serving a JWKS and a token endpoint
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// idToken is returned by the token endpoint for the code "good-code"
+	idToken string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	idp := &testIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		ks := &KeySet{keys: map[string]*signingKey{
+			"idp-key": {id: "idp-key", method: jwt.SigningMethodRS256, public: &key.PublicKey},
+		}}
+		json.NewEncoder(w).Encode(ks.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") != "verifier" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *testIdP) provider() OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:     "test",
+		Issuers:  []string{idp.server.URL},
+		JWKSURL:  idp.server.URL + "/jwks",
+		TokenURL: idp.server.URL + "/token",
+		ClientID: "parkshare-client",
+	})
+}
+
+func (idp *testIdP) sign(t *testing.T, mutate func(*idTokenClaims)) string {
+	t.Helper()
+	claims := &idTokenClaims{
+		Email:         "Renter@Example.com",
+		EmailVerified: true,
+		Name:          "Test Renter",
+		Nonce:         "test-nonce",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   "idp-subject-1",
+			Audience:  jwt.ClaimStrings{"parkshare-client"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if mutate != nil {
+		mutate(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "idp-key"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatalf("failed to sign id token: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCProvider_Verify(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr bool
+	}{
+		{
+			name:  "valid token",
+			token: func() string { return idp.sign(t, nil) },
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				return idp.sign(t, func(c *idTokenClaims) { c.Audience = jwt.ClaimStrings{"someone-else"} })
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				return idp.sign(t, func(c *idTokenClaims) { c.Issuer = "https://evil.example.com" })
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return idp.sign(t, func(c *idTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) })
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong nonce",
+			token: func() string {
+				return idp.sign(t, func(c *idTokenClaims) { c.Nonce = "someone-elses-nonce" })
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing nonce",
+			token: func() string {
+				return idp.sign(t, func(c *idTokenClaims) { c.Nonce = "" })
+			},
+			wantErr: true,
+		},
+		{
+			name: "forged signature",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "x", "aud": "parkshare-client"})
+				token.Header["kid"] = "idp-key"
+				signed, _ := token.SignedString(otherKey)
+				return signed
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := provider.Verify(context.Background(), tt.token(), "test-nonce")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Verify should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if identity.Subject != "idp-subject-1" || identity.Email != "renter@example.com" || !identity.EmailVerified {
+				t.Errorf("Unexpected identity: %+v", identity)
+			}
+		})
+	}
+}
+
+func TestVerifyExternalLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	RegisterProvider("test", idp.provider())
+	defer delete(providers, "test")
+
+	t.Run("authorization code", func(t *testing.T) {
+		nonce, _ := IssueOAuthNonce()
+		idp.idToken = idp.sign(t, func(c *idTokenClaims) { c.Nonce = nonce })
+
+		identity, err := VerifyExternalLogin(context.Background(), "test", "", "good-code", "verifier", nonce)
+		if err != nil {
+			t.Fatalf("VerifyExternalLogin failed: %v", err)
+		}
+		if identity.Provider != "test" {
+			t.Errorf("Provider = %q, want test", identity.Provider)
+		}
+
+		// The same token can't be replayed once its nonce is spent
+		if _, err := VerifyExternalLogin(context.Background(), "test", idp.idToken, "", "", nonce); err == nil {
+			t.Error("A nonce should only be redeemable once")
+		}
+	})
+
+	t.Run("nonce we didn't issue", func(t *testing.T) {
+		idToken := idp.sign(t, func(c *idTokenClaims) { c.Nonce = "made-up" })
+		if _, err := VerifyExternalLogin(context.Background(), "test", idToken, "", "", "made-up"); err == nil {
+			t.Error("VerifyExternalLogin should reject nonces it never issued")
+		}
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		nonce, _ := IssueOAuthNonce()
+		if _, err := VerifyExternalLogin(context.Background(), "test", "", "good-code", "wrong", nonce); err == nil {
+			t.Error("VerifyExternalLogin should fail when the code exchange fails")
+		}
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		if _, err := VerifyExternalLogin(context.Background(), "myspace", idp.idToken, "", "", "test-nonce"); err != ErrUnknownProvider {
+			t.Errorf("Expected ErrUnknownProvider, got %v", err)
+		}
+	})
+
+	t.Run("nothing to verify", func(t *testing.T) {
+		if _, err := VerifyExternalLogin(context.Background(), "test", "", "", "", "test-nonce"); err != ErrInvalidIDToken {
+			t.Errorf("Expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("no nonce", func(t *testing.T) {
+		if _, err := VerifyExternalLogin(context.Background(), "test", idp.sign(t, nil), "", "", ""); err != ErrInvalidIDToken {
+			t.Errorf("Expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+}
+
+func TestPurgeOAuthNonces(t *testing.T) {
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	abandoned, _ := IssueOAuthNonce()
+	clock = clock.Add(oauthNonceTTL + time.Second)
+	fresh, _ := IssueOAuthNonce()
+
+	if _, err := PurgeOAuthNonces(clock); err != nil {
+		t.Fatalf("PurgeOAuthNonces failed: %v", err)
+	}
+
+	store := nonceStore.(*memoryNonceStore)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.nonces[hashToken(abandoned)]; ok {
+		t.Error("Expired nonces should be purged")
+	}
+	if _, ok := store.nonces[hashToken(fresh)]; !ok {
+		t.Error("Live nonces should be kept")
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/mail"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+const passwordResetTTL = time.Hour
+
+// RequestPasswordReset emails a single-use reset link. Unknown addresses
+// succeed silently so the endpoint can't be used to find accounts.
+func RequestPasswordReset(ctx context.Context, email string) error {
+	var user models.User
+	err := database.DB.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	secret, err := issueVerificationToken(user.ID, models.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendLink("/auth/reset-password", url.Values{"token": {secret}})
+	return mail.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your ParkShare password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your ParkShare account. Open the link below to choose a new one. It expires in 1 hour.\n\n%s\n\nIf this wasn't you, you can ignore this email and your password won't change.\n",
+			user.Name, link),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere. Redeeming the emailed link also proves the address.
+func ResetPassword(secret, password string) error {
+	var userID uuid.UUID
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, secret, models.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.First(&user, "id = ?", token.UserID).Error; err != nil {
+			return err
+		}
+
+		if err := setPassword(tx, &user, password); err != nil {
+			return err
+		}
+
+		userID = user.ID
+		return tx.Model(&user).Update("is_verified", true).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return revokeAllSessions(userID, timeNow())
+}
+
+// ChangePassword replaces a password after checking the current one. Every
+// other session is signed out; the caller gets a fresh token pair. Checks
+// of the current password are throttled per user like logins are.
+func ChangePassword(userID uuid.UUID, currentPassword, newPassword string, client ClientInfo) (*TokenPair, error) {
+	keys := passwordChangeThrottleKeys(userID)
+	if err := throttleAttempt(keys); err != nil {
+		return nil, err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		if user.PasswordHash == nil || !CheckPassword(currentPassword, *user.PasswordHash) {
+			return ErrWrongPassword
+		}
+
+		return setPassword(tx, &user, newPassword)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clearLoginFailures(keys); err != nil {
+		return nil, err
+	}
+
+	if err := revokeAllSessions(userID, timeNow()); err != nil {
+		return nil, err
+	}
+
+	return GenerateTokens(userID, client)
+}
+
+// setPassword stores a new password hash and makes sure the user has an
+// email identity to log in with it
+func setPassword(tx *gorm.DB, user *models.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(user).Update("password_hash", hash).Error; err != nil {
+		return err
+	}
+
+	identity := emailIdentity(user.ID, user.Email)
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(identity).Error
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownRole      = errors.New("unknown role")
+	ErrCannotDemoteSelf = errors.New("cannot remove your own admin role")
+)
+
+// Permission is a single thing a role allows
+type Permission string
+
+const (
+	// PermSpotsWrite allows listing and managing your own spots
+	PermSpotsWrite Permission = "spots:write"
+	// PermSpotsManageAny allows managing spots regardless of owner
+	PermSpotsManageAny Permission = "spots:manage_any"
+	// PermBookingsWrite allows booking spots and managing your own bookings
+	PermBookingsWrite Permission = "bookings:write"
+	// PermBookingsManageAny allows managing bookings regardless of owner
+	PermBookingsManageAny Permission = "bookings:manage_any"
+	// PermAdminAccess allows reaching the admin API at all
+	PermAdminAccess Permission = "admin:access"
+	// PermUsersManage allows changing other users' roles
+	PermUsersManage Permission = "users:manage"
+	// PermAuditRead allows reading the security audit log
+	PermAuditRead Permission = "audit:read"
+	// PermUsersImpersonate allows acting as another user for support
+	PermUsersImpersonate Permission = "users:impersonate"
+)
+
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleRenter: {PermBookingsWrite},
+	models.RoleHost:   {PermSpotsWrite},
+	models.RoleAdmin: {
+		PermSpotsWrite, PermSpotsManageAny,
+		PermBookingsWrite, PermBookingsManageAny,
+		PermAdminAccess, PermUsersManage, PermAuditRead, PermUsersImpersonate,
+	},
+}
+
+// HasPermission reports whether any of the caller's roles grants perm. API
+// key callers are further limited to the key's scopes.
+func HasPermission(claims *Claims, perm Permission) bool {
+	if claims == nil {
+		return false
+	}
+	if claims.APIKeyID != uuid.Nil && !slices.Contains(claims.Scopes, perm) {
+		return false
+	}
+	for _, role := range claims.Roles {
+		if slices.Contains(rolePermissions[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy decides who may act on an owned resource: its owner with the Own
+// permission, or anyone with the Any permission
+type Policy struct {
+	Own Permission
+	Any Permission
+}
+
+var (
+	SpotPolicy    = Policy{Own: PermSpotsWrite, Any: PermSpotsManageAny}
+	BookingPolicy = Policy{Own: PermBookingsWrite, Any: PermBookingsManageAny}
+)
+
+// Allows reports whether the caller may act on a resource owned by ownerID
+func (p Policy) Allows(claims *Claims, ownerID uuid.UUID) bool {
+	if HasPermission(claims, p.Any) {
+		return true
+	}
+	return claims != nil && claims.UserID == ownerID && HasPermission(claims, p.Own)
+}
+
+// RequirePermission only lets through callers whose roles grant perm. It
+// must run after Middleware.
+func RequirePermission(perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasPermission(GetUserFromContext(r.Context()), perm) {
+				AuditDenied(r, "", "", "missing permission "+string(perm))
+				util.WriteError(w, http.StatusForbidden, "Insufficient permissions")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RoleStore looks up the roles granted to a user
+type RoleStore interface {
+	Roles(userID uuid.UUID) ([]models.Role, error)
+}
+
+var roleStore RoleStore = gormRoleStore{}
+
+// SetRoleStore replaces the store used to look up roles
+func SetRoleStore(store RoleStore) {
+	roleStore = store
+}
+
+type gormRoleStore struct{}
+
+func (gormRoleStore) Roles(userID uuid.UUID) ([]models.Role, error) {
+	var roles []models.Role
+	err := database.DB.Model(&models.UserRole{}).
+		Where("user_id = ?", userID).
+		Order("role").
+		Pluck("role", &roles).Error
+	return roles, err
+}
+
+// grantDefaultRoles gives a new account the roles every user starts with
+func grantDefaultRoles(tx *gorm.DB, userID uuid.UUID) error {
+	rows := make([]models.UserRole, len(models.DefaultRoles))
+	for i, role := range models.DefaultRoles {
+		rows[i] = models.UserRole{UserID: userID, Role: role}
+	}
+	return tx.Create(&rows).Error
+}
+
+// SetUserRoles replaces a user's roles. Changes reach the user's claims the
+// next time their tokens are refreshed.
+func SetUserRoles(actorID, userID uuid.UUID, roles []models.Role) ([]models.Role, error) {
+	for _, role := range roles {
+		if _, ok := rolePermissions[role]; !ok {
+			return nil, ErrUnknownRole
+		}
+	}
+
+	// Otherwise the last admin could lock everyone out of the admin API
+	if actorID == userID && !slices.Contains(roles, models.RoleAdmin) {
+		return nil, ErrCannotDemoteSelf
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.User{}, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+
+		slices.Sort(roles)
+		roles = slices.Compact(roles)
+		if len(roles) == 0 {
+			return nil
+		}
+
+		rows := make([]models.UserRole, len(roles))
+		for i, role := range roles {
+			rows[i] = models.UserRole{UserID: userID, Role: role}
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
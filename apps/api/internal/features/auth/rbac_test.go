@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// memoryRoleStore gives every user the default roles, or the ones set here
+type memoryRoleStore map[uuid.UUID][]models.Role
+
+func (s memoryRoleStore) Roles(userID uuid.UUID) ([]models.Role, error) {
+	if roles, ok := s[userID]; ok {
+		return roles, nil
+	}
+	return models.DefaultRoles, nil
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []models.Role
+		perm  Permission
+		want  bool
+	}{
+		{name: "host writes spots", roles: []models.Role{models.RoleHost}, perm: PermSpotsWrite, want: true},
+		{name: "renter cannot write spots", roles: []models.Role{models.RoleRenter}, perm: PermSpotsWrite, want: false},
+		{name: "renter books", roles: []models.Role{models.RoleRenter}, perm: PermBookingsWrite, want: true},
+		{name: "host cannot manage any spot", roles: []models.Role{models.RoleHost}, perm: PermSpotsManageAny, want: false},
+		{name: "admin manages any spot", roles: []models.Role{models.RoleAdmin}, perm: PermSpotsManageAny, want: true},
+		{name: "defaults lack admin access", roles: models.DefaultRoles, perm: PermAdminAccess, want: false},
+		{name: "no roles", roles: nil, perm: PermBookingsWrite, want: false},
+		{name: "unknown role", roles: []models.Role{"superuser"}, perm: PermAdminAccess, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{UserID: uuid.New(), Roles: tt.roles}
+			if got := HasPermission(claims, tt.perm); got != tt.want {
+				t.Errorf("HasPermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpotPolicy(t *testing.T) {
+	owner := uuid.New()
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   bool
+	}{
+		{name: "owner host", claims: &Claims{UserID: owner, Roles: []models.Role{models.RoleHost}}, want: true},
+		{name: "owner without host role", claims: &Claims{UserID: owner, Roles: []models.Role{models.RoleRenter}}, want: false},
+		{name: "other host", claims: &Claims{UserID: uuid.New(), Roles: []models.Role{models.RoleHost}}, want: false},
+		{name: "admin", claims: &Claims{UserID: uuid.New(), Roles: []models.Role{models.RoleAdmin}}, want: true},
+		{name: "anonymous", claims: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SpotPolicy.Allows(tt.claims, owner); got != tt.want {
+				t.Errorf("SpotPolicy.Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission(PermAdminAccess)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name  string
+		roles []models.Role
+		want  int
+	}{
+		{name: "admin", roles: []models.Role{models.RoleAdmin}, want: http.StatusOK},
+		{name: "host", roles: []models.Role{models.RoleHost}, want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{UserID: uuid.New(), Roles: tt.roles}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), UserContextKey, claims))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTokens_CarriesRoles(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	store := roleStore.(memoryRoleStore)
+	userID := uuid.New()
+	store[userID] = []models.Role{models.RoleAdmin}
+	defer delete(store, userID)
+
+	claims := accessClaims(t, mustGenerateTokens(t, userID))
+	if !slices.Equal(claims.Roles, []models.Role{models.RoleAdmin}) {
+		t.Errorf("Roles = %v, want [admin]", claims.Roles)
+	}
+}
@@ -2,20 +2,53 @@ package auth
 
 import (
 	"errors"
-	"os"
+	"log"
 	"time"
 	"net/mail"
+	"strings"
 
 	"github.com/brandon-kong/parkshare/apps/api/internal/database"
 	"github.com/brandon-kong/parkshare/apps/api/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 var (
 	ErrInvalidCredentials 	= errors.New("invalid credentials")
 	ErrUserExists		  	= errors.New("user already exists")
+	ErrTokenRevoked			= errors.New("token revoked")
+	ErrTokenReused			= errors.New("refresh token reused")
+	ErrWrongTokenType		= errors.New("wrong token type")
+)
+
+// TokenType says what a token may be used for. Each type also gets its own
+// audience so a token presented at the wrong place fails standard aud checks.
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+	// TokenTypeMFA is the challenge handed out between a correct password and
+	// a correct second factor
+	TokenTypeMFA TokenType = "mfa"
+)
+
+const tokenIssuer = "parkshare"
+
+var tokenAudiences = map[TokenType]string{
+	TokenTypeAccess:  "parkshare-api",
+	TokenTypeRefresh: "parkshare-auth",
+	TokenTypeMFA:     "parkshare-mfa",
+}
+
+// timeNow is swapped for a fixed clock in tests
+var timeNow = time.Now
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+	mfaChallengeTTL = 5 * time.Minute
 )
 
 type TokenPair struct {
@@ -24,50 +57,103 @@ type TokenPair struct {
 }
 
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	TokenType TokenType `json:"token_type"`
+	// AuthTime is when the user last proved their credentials. It survives
+	// refreshes, so sensitive actions can demand a recent login.
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	// SessionID ties the token to the signed-in device it was issued to
+	SessionID uuid.UUID `json:"sid,omitempty"`
+	// Roles are the user's roles when the token was issued
+	Roles []models.Role `json:"roles,omitempty"`
+	// Actor is set when an admin is acting as UserID
+	Actor *Actor `json:"act,omitempty"`
+	// APIKeyID and Scopes are set when the caller used an API key instead
+	// of a token. They're never signed into a JWT.
+	APIKeyID uuid.UUID    `json:"-"`
+	Scopes   []Permission `json:"-"`
 	jwt.RegisteredClaims
 }
 
-// HashPassword hashes a plain text password
+// HashPassword hashes a plain text password with Argon2id at the configured cost
 func HashPassword(password string) (string, error) {
-    bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-    return string(bytes), err
+    return hashArgon2id(password, passwordParams)
 }
 
-// CheckPassword compares a password with a hash
+// CheckPassword compares a password with a hash. Hashes from before the move
+// to Argon2id are bcrypt, and still verify.
 func CheckPassword(password, hash string) bool {
-    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-    return err == nil
+    if strings.HasPrefix(hash, argon2idPrefix) {
+        return checkArgon2id(password, hash)
+    }
+    return checkBcrypt(password, hash)
 }
 
-// GenerateTokens creates an access and refresh token pair
-func GenerateTokens(userID uuid.UUID) (*TokenPair, error) {
-    secret := []byte(os.Getenv("JWT_SECRET"))
+// GenerateTokens creates an access and refresh token pair for a new login,
+// starting a session for the client whose ID is the new refresh token family
+func GenerateTokens(userID uuid.UUID, client ClientInfo) (*TokenPair, error) {
+    now := timeNow()
+    sessionID, err := startSession(userID, client, now)
+    if err != nil {
+        return nil, err
+    }
+    return issueTokens(userID, sessionID, now)
+}
 
-    // Access token - 15 minutes
-    accessClaims := &Claims{
-        UserID: userID,
+// newClaims builds the claims shared by every token type
+func newClaims(userID uuid.UUID, tokenType TokenType, now time.Time, ttl time.Duration) *Claims {
+    return &Claims{
+        UserID:    userID,
+        TokenType: tokenType,
         RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-            IssuedAt:  jwt.NewNumericDate(time.Now()),
+            Issuer:    tokenIssuer,
+            Subject:   userID.String(),
+            Audience:  jwt.ClaimStrings{tokenAudiences[tokenType]},
+            ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+            IssuedAt:  jwt.NewNumericDate(now),
         },
     }
-    accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-    accessString, err := accessToken.SignedString(secret)
+}
+
+// issueTokens signs a token pair and records the refresh token in familyID
+func issueTokens(userID, familyID uuid.UUID, authTime time.Time) (*TokenPair, error) {
+    now := timeNow()
+
+    // Loaded on every issue so role changes apply from the next refresh
+    roles, err := roleStore.Roles(userID)
     if err != nil {
         return nil, err
     }
 
-    // Refresh token - 7 days
-    refreshClaims := &Claims{
-        UserID: userID,
-        RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-            IssuedAt:  jwt.NewNumericDate(time.Now()),
-        },
+    // Access token - 15 minutes
+    accessClaims := newClaims(userID, TokenTypeAccess, now, accessTokenTTL)
+    accessClaims.AuthTime = jwt.NewNumericDate(authTime)
+    accessClaims.SessionID = familyID
+    accessClaims.Roles = roles
+    accessString, err := signToken(accessClaims)
+    if err != nil {
+        return nil, err
     }
-    refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-    refreshString, err := refreshToken.SignedString(secret)
+
+    // Refresh token - 7 days. The jti doubles as the stored row ID and keeps
+    // tokens issued within the same second distinct.
+    refreshID := uuid.New()
+    refreshClaims := newClaims(userID, TokenTypeRefresh, now, refreshTokenTTL)
+    refreshClaims.ID = refreshID.String()
+    refreshClaims.AuthTime = jwt.NewNumericDate(authTime)
+    refreshClaims.SessionID = familyID
+    refreshString, err := signToken(refreshClaims)
+    if err != nil {
+        return nil, err
+    }
+
+    err = refreshStore.Create(&models.RefreshToken{
+        ID:        refreshID,
+        UserID:    userID,
+        FamilyID:  familyID,
+        TokenHash: hashToken(refreshString),
+        ExpiresAt: now.Add(refreshTokenTTL),
+    })
     if err != nil {
         return nil, err
     }
@@ -78,27 +164,36 @@ func GenerateTokens(userID uuid.UUID) (*TokenPair, error) {
     }, nil
 }
 
-// ValidateToken validates a JWT and returns the claims
-func ValidateToken(tokenString string) (*Claims, error) {
-    secret := []byte(os.Getenv("JWT_SECRET"))
-
-    token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-        return secret, nil
-    })
+// ValidateToken validates a JWT and returns the claims. The token must have
+// been issued by us for the given use; an access token is never accepted as
+// a refresh token or vice versa.
+func ValidateToken(tokenString string, tokenType TokenType) (*Claims, error) {
+    token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey,
+        jwt.WithValidMethods(validSigningMethods),
+        jwt.WithIssuer(tokenIssuer),
+        jwt.WithAudience(tokenAudiences[tokenType]),
+        jwt.WithExpirationRequired(),
+        jwt.WithTimeFunc(timeNow),
+    )
 
     if err != nil {
         return nil, err
     }
 
-    if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-        return claims, nil
+    claims, ok := token.Claims.(*Claims)
+    if !ok || !token.Valid {
+        return nil, errors.New("invalid token")
     }
 
-    return nil, errors.New("invalid token")
+    if claims.TokenType != tokenType {
+        return nil, ErrWrongTokenType
+    }
+
+    return claims, nil
 }
 
 // CreateUser registers a new user
-func CreateUser(email, password, name string) (*models.User, *TokenPair, error) {
+func CreateUser(email, password, name string, client ClientInfo) (*models.User, *TokenPair, error) {
     // Check if user exists
     var existing models.User
     if err := database.DB.Where("email = ?", email).First(&existing).Error; err == nil {
@@ -120,12 +215,21 @@ func CreateUser(email, password, name string) (*models.User, *TokenPair, error)
         IsVerified:   false,
     }
 
-    if err := database.DB.Create(user).Error; err != nil {
+    err = database.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(user).Error; err != nil {
+            return err
+        }
+        if err := grantDefaultRoles(tx, user.ID); err != nil {
+            return err
+        }
+        return tx.Create(emailIdentity(user.ID, email)).Error
+    })
+    if err != nil {
         return nil, nil, err
     }
 
     // Generate tokens
-    tokens, err := GenerateTokens(user.ID)
+    tokens, err := GenerateTokens(user.ID, client)
     if err != nil {
         return nil, nil, err
     }
@@ -133,33 +237,126 @@ func CreateUser(email, password, name string) (*models.User, *TokenPair, error)
     return user, tokens, nil
 }
 
-// AuthenticateUser logs in a user
-func AuthenticateUser(email, password string) (*models.User, *TokenPair, error) {
+// AuthenticateUser checks a user's password. Users with two-factor enabled
+// get an MFA challenge instead of tokens. Repeated failures for an email, or
+// for an email from one IP, lock further attempts out for a growing period.
+func AuthenticateUser(email, password string, client ClientInfo) (*models.User, *LoginResult, error) {
+    keys := loginThrottleKeys(email, client.IP)
+    if err := throttleAttempt(keys); err != nil {
+        return nil, nil, err
+    }
+
     var user models.User
-    if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
-        return nil, nil, ErrInvalidCredentials
+    err := database.DB.Where("email = ?", email).First(&user).Error
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil, err
     }
 
-	if user.PasswordHash == nil || !CheckPassword(password, *user.PasswordHash) {
+    // Unknown emails and passwordless accounts still pay for a hash check so
+    // response times don't say which emails are registered
+    if err != nil || user.PasswordHash == nil {
+        equalizePasswordTiming(password)
+    }
+
+	if err != nil || user.PasswordHash == nil || !CheckPassword(password, *user.PasswordHash) {
 		return nil, nil, ErrInvalidCredentials
     }
 
-    tokens, err := GenerateTokens(user.ID)
+    if err := clearLoginFailures(keys); err != nil {
+        return nil, nil, err
+    }
+
+    // This is the only time we have the password, so upgrade old hashes now
+    if NeedsRehash(*user.PasswordHash) {
+        if err := rehashPassword(&user, password); err != nil {
+            log.Printf("failed to upgrade password hash for user %s: %v\n", user.ID, err)
+        }
+    }
+
+    result, err := startLogin(user.ID, client)
     if err != nil {
         return nil, nil, err
     }
 
-    return &user, tokens, nil
+    return &user, result, nil
+}
+
+// rehashPassword stores a fresh hash of a user's password at the current cost
+func rehashPassword(user *models.User, password string) error {
+    hash, err := HashPassword(password)
+    if err != nil {
+        return err
+    }
+
+    // Only swap the hash we checked, in case the password changed meanwhile
+    result := database.DB.Model(&models.User{}).
+        Where("id = ? AND password_hash = ?", user.ID, *user.PasswordHash).
+        Update("password_hash", hash)
+    if result.Error != nil {
+        return result.Error
+    }
+
+    user.PasswordHash = &hash
+    return nil
 }
 
-// RefreshTokens generates new tokens from a refresh token
-func RefreshTokens(refreshToken string) (*TokenPair, error) {
-    claims, err := ValidateToken(refreshToken)
+// RefreshTokens rotates a refresh token: the presented token is consumed and
+// a new pair is issued in the same family. Presenting a token that was
+// already used revokes the whole family, since one of the two holders must
+// have stolen it. The family's session is marked as seen from client.
+func RefreshTokens(refreshToken string, client ClientInfo) (*TokenPair, error) {
+    claims, err := ValidateToken(refreshToken, TokenTypeRefresh)
     if err != nil {
         return nil, err
     }
 
-    return GenerateTokens(claims.UserID)
+    stored, err := refreshStore.FindByHash(hashToken(refreshToken))
+    if err != nil {
+        return nil, err
+    }
+
+    if stored.UserID != claims.UserID {
+        return nil, errors.New("invalid token")
+    }
+
+    if stored.RevokedAt != nil {
+        return nil, ErrTokenRevoked
+    }
+
+    now := timeNow()
+    ok, err := refreshStore.MarkUsed(stored.ID, now)
+    if err != nil {
+        return nil, err
+    }
+
+    if !ok {
+        if err := revokeSession(stored.FamilyID, now); err != nil {
+            return nil, err
+        }
+        return nil, ErrTokenReused
+    }
+
+    if err := sessionStore.Touch(stored.FamilyID, now, client); err != nil {
+        return nil, err
+    }
+
+    authTime := now
+    if claims.AuthTime != nil {
+        authTime = claims.AuthTime.Time
+    }
+
+    return issueTokens(stored.UserID, stored.FamilyID, authTime)
+}
+
+// RevokeRefreshToken revokes the session the given refresh token belongs to,
+// signing out that login on every token issued from it
+func RevokeRefreshToken(refreshToken string) error {
+    stored, err := refreshStore.FindByHash(hashToken(refreshToken))
+    if err != nil {
+        return err
+    }
+
+    return revokeSession(stored.FamilyID, timeNow())
 }
 
 func validateRegister(req RegisterRequest) map[string]string {
@@ -169,8 +366,8 @@ func validateRegister(req RegisterRequest) map[string]string {
         errors["email"] = "Invalid email format"
     }
 
-    if len(req.Password) < 8 {
-        errors["password"] = "Password must be at least 8 characters"
+    if msg := validatePassword(req.Password); msg != "" {
+        errors["password"] = msg
     }
 
     if req.Name == "" {
@@ -180,37 +377,108 @@ func validateRegister(req RegisterRequest) map[string]string {
     return errors
 }
 
+// validatePassword returns why a new password is unacceptable, or "" if it's fine
+func validatePassword(password string) string {
+    if len(password) < 8 {
+        return "Password must be at least 8 characters"
+    }
+    return ""
+}
+
 // internal/features/auth/service.go
 
-func FindOrCreateOAuthUser(provider, email, name, avatarURL string) (*models.User, *TokenPair, error) {
+// FindOrCreateOAuthUser logs in the user behind a verified external identity,
+// creating an account on first login. The identity must come from
+// VerifyExternalLogin, never from the request body. An existing account with
+// the same email is never merged into silently; its owner has to sign in and
+// link the provider explicitly.
+func FindOrCreateOAuthUser(identity *ExternalIdentity, client ClientInfo) (*models.User, *LoginResult, error) {
     var user models.User
 
-    // Check if user exists
-    err := database.DB.Where("email = ?", email).First(&user).Error
+    // Known identity, log in whoever it's linked to
+    linked, err := findIdentity(database.DB, identity.Provider, identity.Subject)
+    if err == nil {
+        if err := database.DB.First(&user, "id = ?", linked.UserID).Error; err != nil {
+            return nil, nil, err
+        }
+        result, err := startLogin(user.ID, client)
+        return &user, result, err
+    }
+    if err != ErrIdentityNotFound {
+        return nil, nil, err
+    }
+
+    // An unverified email could belong to anyone, so it can't be used to
+    // find or claim an account
+    if !identity.EmailVerified {
+        return nil, nil, ErrEmailNotVerified
+    }
+
+    err = database.DB.Where("email = ?", identity.Email).First(&user).Error
     if err == nil {
-        // User exists, generate tokens
-        tokens, err := GenerateTokens(user.ID)
-        return &user, tokens, err
+        // Accounts this provider created before identities were tracked are
+        // adopted; anything else needs an explicit link
+        if user.Provider != identity.Provider {
+            return nil, nil, ErrAccountExists
+        }
+
+        var count int64
+        if err := database.DB.Model(&models.UserIdentity{}).
+            Where("user_id = ? AND provider = ?", user.ID, identity.Provider).
+            Count(&count).Error; err != nil {
+            return nil, nil, err
+        }
+        if count > 0 {
+            return nil, nil, ErrAccountExists
+        }
+
+        if _, err := LinkIdentity(user.ID, identity); err != nil {
+            return nil, nil, err
+        }
+
+        result, err := startLogin(user.ID, client)
+        return &user, result, err
+    }
+    if !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil, err
     }
 
     // Create new user
     user = models.User{
         ID:         uuid.New(),
-        Email:      email,
-        Name:       name,
-        AvatarURL:  &avatarURL,
-        Provider:   provider,
+        Email:      identity.Email,
+        Name:       identity.Name,
+        Provider:   identity.Provider,
         IsVerified: true,
     }
 
-    if err := database.DB.Create(&user).Error; err != nil {
+    if identity.AvatarURL != "" {
+        user.AvatarURL = &identity.AvatarURL
+    }
+
+    err = database.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&user).Error; err != nil {
+            return err
+        }
+        if err := grantDefaultRoles(tx, user.ID); err != nil {
+            return err
+        }
+        return tx.Create(&models.UserIdentity{
+            ID:       uuid.New(),
+            UserID:   user.ID,
+            Provider: identity.Provider,
+            Subject:  identity.Subject,
+            Email:    identity.Email,
+        }).Error
+    })
+    if err != nil {
         return nil, nil, err
     }
 
-    tokens, err := GenerateTokens(user.ID)
+    result, err := startLogin(user.ID, client)
     if err != nil {
         return nil, nil, err
     }
 
-    return &user, tokens, nil
-}
\ No newline at end of file
+    return &user, result, nil
+}
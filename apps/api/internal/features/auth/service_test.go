@@ -90,7 +90,7 @@ func TestGenerateTokens(t *testing.T) {
 
 	userID := uuid.New()
 
-	tokens, err := GenerateTokens(userID)
+	tokens, err := GenerateTokens(userID, ClientInfo{})
 	if err != nil {
 		t.Fatalf("GenerateTokens failed: %v", err)
 	}
@@ -114,10 +114,10 @@ func TestValidateToken(t *testing.T) {
 	defer os.Unsetenv("JWT_SECRET")
 
 	userID := uuid.New()
-	tokens, _ := GenerateTokens(userID)
+	tokens, _ := GenerateTokens(userID, ClientInfo{})
 
 	t.Run("valid access token", func(t *testing.T) {
-		claims, err := ValidateToken(tokens.AccessToken)
+		claims, err := ValidateToken(tokens.AccessToken, TokenTypeAccess)
 		if err != nil {
 			t.Fatalf("ValidateToken failed for valid token: %v", err)
 		}
@@ -128,7 +128,7 @@ func TestValidateToken(t *testing.T) {
 	})
 
 	t.Run("valid refresh token", func(t *testing.T) {
-		claims, err := ValidateToken(tokens.RefreshToken)
+		claims, err := ValidateToken(tokens.RefreshToken, TokenTypeRefresh)
 		if err != nil {
 			t.Fatalf("ValidateToken failed for valid refresh token: %v", err)
 		}
@@ -138,8 +138,22 @@ func TestValidateToken(t *testing.T) {
 		}
 	})
 
+	t.Run("refresh token used as access token", func(t *testing.T) {
+		_, err := ValidateToken(tokens.RefreshToken, TokenTypeAccess)
+		if err == nil {
+			t.Error("ValidateToken should reject a refresh token where an access token is expected")
+		}
+	})
+
+	t.Run("access token used as refresh token", func(t *testing.T) {
+		_, err := ValidateToken(tokens.AccessToken, TokenTypeRefresh)
+		if err == nil {
+			t.Error("ValidateToken should reject an access token where a refresh token is expected")
+		}
+	})
+
 	t.Run("invalid token", func(t *testing.T) {
-		_, err := ValidateToken("invalid-token")
+		_, err := ValidateToken("invalid-token", TokenTypeAccess)
 		if err == nil {
 			t.Error("ValidateToken should fail for invalid token")
 		}
@@ -148,10 +162,10 @@ func TestValidateToken(t *testing.T) {
 	t.Run("wrong secret", func(t *testing.T) {
 		// Generate token with different secret
 		os.Setenv("JWT_SECRET", "different-secret")
-		wrongTokens, _ := GenerateTokens(userID)
+		wrongTokens, _ := GenerateTokens(userID, ClientInfo{})
 		os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
 
-		_, err := ValidateToken(wrongTokens.AccessToken)
+		_, err := ValidateToken(wrongTokens.AccessToken, TokenTypeAccess)
 		if err == nil {
 			t.Error("ValidateToken should fail for token signed with different secret")
 		}
@@ -166,17 +180,11 @@ func TestValidateToken_Expired(t *testing.T) {
 	secret := []byte(os.Getenv("JWT_SECRET"))
 
 	// Create an expired token
-	expiredClaims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-1 * time.Hour)), // Expired 1 hour ago
-			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-2 * time.Hour)),
-		},
-	}
+	expiredClaims := newClaims(userID, TokenTypeAccess, time.Now().Add(-2*time.Hour), time.Hour) // Expired 1 hour ago
 	expiredToken := jwt.NewWithClaims(jwt.SigningMethodHS256, expiredClaims)
 	expiredString, _ := expiredToken.SignedString(secret)
 
-	_, err := ValidateToken(expiredString)
+	_, err := ValidateToken(expiredString, TokenTypeAccess)
 	if err == nil {
 		t.Error("ValidateToken should fail for expired token")
 	}
@@ -187,12 +195,12 @@ func TestRefreshTokens(t *testing.T) {
 	defer os.Unsetenv("JWT_SECRET")
 
 	userID := uuid.New()
-	originalTokens, _ := GenerateTokens(userID)
+	originalTokens, _ := GenerateTokens(userID, ClientInfo{})
 
 	// Wait a tiny bit to ensure new tokens have different timestamps
 	time.Sleep(10 * time.Millisecond)
 
-	newTokens, err := RefreshTokens(originalTokens.RefreshToken)
+	newTokens, err := RefreshTokens(originalTokens.RefreshToken, ClientInfo{})
 	if err != nil {
 		t.Fatalf("RefreshTokens failed: %v", err)
 	}
@@ -202,7 +210,7 @@ func TestRefreshTokens(t *testing.T) {
 	}
 
 	// Verify the new tokens are valid and contain the same user ID
-	claims, err := ValidateToken(newTokens.AccessToken)
+	claims, err := ValidateToken(newTokens.AccessToken, TokenTypeAccess)
 	if err != nil {
 		t.Fatalf("New access token is invalid: %v", err)
 	}
@@ -216,12 +224,37 @@ func TestRefreshTokens_InvalidToken(t *testing.T) {
 	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
 	defer os.Unsetenv("JWT_SECRET")
 
-	_, err := RefreshTokens("invalid-refresh-token")
+	_, err := RefreshTokens("invalid-refresh-token", ClientInfo{})
 	if err == nil {
 		t.Error("RefreshTokens should fail with invalid token")
 	}
 }
 
+func TestRefreshTokens_RejectsAccessToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	tokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+
+	_, err := RefreshTokens(tokens.AccessToken, ClientInfo{})
+	if err == nil {
+		t.Error("RefreshTokens should fail when given an access token")
+	}
+}
+
+func TestValidateToken_RejectsNoneAlgorithm(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	claims := newClaims(uuid.New(), TokenTypeAccess, time.Now(), time.Hour)
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	tokenString, _ := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	if _, err := ValidateToken(tokenString, TokenTypeAccess); err == nil {
+		t.Error("ValidateToken should reject unsigned tokens")
+	}
+}
+
 func TestValidateRegister(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -302,13 +335,31 @@ func TestTokenPairStructure(t *testing.T) {
 	defer os.Unsetenv("JWT_SECRET")
 
 	userID := uuid.New()
-	tokens, _ := GenerateTokens(userID)
+	tokens, _ := GenerateTokens(userID, ClientInfo{})
 
 	// Verify access token expires sooner than refresh token
-	accessClaims, _ := ValidateToken(tokens.AccessToken)
-	refreshClaims, _ := ValidateToken(tokens.RefreshToken)
+	accessClaims, _ := ValidateToken(tokens.AccessToken, TokenTypeAccess)
+	refreshClaims, _ := ValidateToken(tokens.RefreshToken, TokenTypeRefresh)
 
 	if accessClaims.ExpiresAt.Time.After(refreshClaims.ExpiresAt.Time) {
 		t.Error("Access token should expire before refresh token")
 	}
 }
+
+func TestRefreshTokens_PreservesAuthTime(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	loggedInAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	tokens, _ := issueTokens(uuid.New(), uuid.New(), loggedInAt)
+
+	refreshed, err := RefreshTokens(tokens.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens failed: %v", err)
+	}
+
+	claims, _ := ValidateToken(refreshed.AccessToken, TokenTypeAccess)
+	if claims.AuthTime == nil || !claims.AuthTime.Time.Equal(loggedInAt) {
+		t.Errorf("AuthTime = %v, want %v", claims.AuthTime, loggedInAt)
+	}
+}
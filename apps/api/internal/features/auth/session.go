@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// ClientInfo describes the device a login came from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// clientInfo reads the device details off a request
+func clientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{UserAgent: util.UserAgent(r), IP: util.ClientIP(r)}
+}
+
+// SessionStore persists signed-in sessions
+type SessionStore interface {
+	Create(session *models.Session) error
+	Find(id uuid.UUID) (*models.Session, error)
+	// Touch records that a session was just used, from client
+	Touch(id uuid.UUID, at time.Time, client ClientInfo) error
+	// ListActive returns a user's unrevoked sessions seen since the given time
+	ListActive(userID uuid.UUID, since time.Time) ([]models.Session, error)
+	Revoke(id uuid.UUID, at time.Time) error
+	RevokeUser(userID uuid.UUID, at time.Time) error
+}
+
+var sessionStore SessionStore = gormSessionStore{}
+
+// SetSessionStore replaces the store used for sessions
+func SetSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// startSession records a new session for a login
+func startSession(userID uuid.UUID, client ClientInfo, now time.Time) (uuid.UUID, error) {
+	session := &models.Session{
+		ID:         uuid.New(),
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if err := sessionStore.Create(session); err != nil {
+		return uuid.Nil, err
+	}
+	return session.ID, nil
+}
+
+// sessionActive reports whether the session an access token was issued for
+// is still signed in. Tokens without a session predate session tracking and
+// are left to expire on their own.
+func sessionActive(claims *Claims) (bool, error) {
+	if claims.SessionID == uuid.Nil {
+		return true, nil
+	}
+
+	session, err := sessionStore.Find(claims.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Impersonation tokens ride on the admin's own session
+	owner := claims.UserID
+	if claims.Actor != nil {
+		owner = claims.Actor.UserID
+	}
+
+	return session.RevokedAt == nil && session.UserID == owner, nil
+}
+
+// ListSessions returns the devices a user is signed in on, most recent first
+func ListSessions(userID uuid.UUID) ([]models.Session, error) {
+	return sessionStore.ListActive(userID, timeNow().Add(-refreshTokenTTL))
+}
+
+// RevokeSession signs one of a user's sessions out, along with every refresh
+// token issued to it
+func RevokeSession(userID, sessionID uuid.UUID) error {
+	session, err := sessionStore.Find(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	return revokeSession(sessionID, timeNow())
+}
+
+// RevokeOtherSessions signs a user out everywhere except the current session
+func RevokeOtherSessions(userID, currentID uuid.UUID) error {
+	sessions, err := ListSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+	for _, session := range sessions {
+		if session.ID == currentID {
+			continue
+		}
+		if err := revokeSession(session.ID, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func revokeSession(sessionID uuid.UUID, at time.Time) error {
+	if err := refreshStore.RevokeFamily(sessionID, at); err != nil {
+		return err
+	}
+	return sessionStore.Revoke(sessionID, at)
+}
+
+// revokeAllSessions signs a user out everywhere
+func revokeAllSessions(userID uuid.UUID, at time.Time) error {
+	if err := refreshStore.RevokeUser(userID, at); err != nil {
+		return err
+	}
+	return sessionStore.RevokeUser(userID, at)
+}
+
+// SignOutEverywhere revokes every session and refresh token a user has
+func SignOutEverywhere(userID uuid.UUID) error {
+	return revokeAllSessions(userID, timeNow())
+}
+
+type gormSessionStore struct{}
+
+func (gormSessionStore) Create(session *models.Session) error {
+	return database.DB.Create(session).Error
+}
+
+func (gormSessionStore) Find(id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := database.DB.First(&session, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (gormSessionStore) Touch(id uuid.UUID, at time.Time, client ClientInfo) error {
+	return database.DB.Model(&models.Session{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_seen_at": at,
+			"user_agent":   client.UserAgent,
+			"ip":           client.IP,
+		}).Error
+}
+
+func (gormSessionStore) ListActive(userID uuid.UUID, since time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND last_seen_at > ?", userID, since).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (gormSessionStore) Revoke(id uuid.UUID, at time.Time) error {
+	return database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at).Error
+}
+
+func (gormSessionStore) RevokeUser(userID uuid.UUID, at time.Time) error {
+	return database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// memorySessionStore keeps sessions in memory so token tests don't need a database
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*models.Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[uuid.UUID]*models.Session)}
+}
+
+func (s *memorySessionStore) Create(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+func (s *memorySessionStore) Find(id uuid.UUID) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (s *memorySessionStore) Touch(id uuid.UUID, at time.Time, client ClientInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok {
+		session.LastSeenAt = at
+		session.UserAgent = client.UserAgent
+		session.IP = client.IP
+	}
+	return nil
+}
+
+func (s *memorySessionStore) ListActive(userID uuid.UUID, since time.Time) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && session.LastSeenAt.After(since) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (s *memorySessionStore) Revoke(id uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[id]; ok && session.RevokedAt == nil {
+		session.RevokedAt = &at
+	}
+	return nil
+}
+
+func (s *memorySessionStore) RevokeUser(userID uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func accessClaims(t *testing.T, tokens *TokenPair) *Claims {
+	t.Helper()
+	claims, err := ValidateToken(tokens.AccessToken, TokenTypeAccess)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	return claims
+}
+
+func TestGenerateTokens_StartsSession(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	userID := uuid.New()
+	client := ClientInfo{UserAgent: "Firefox", IP: "203.0.113.7"}
+	tokens, _ := GenerateTokens(userID, client)
+
+	claims := accessClaims(t, tokens)
+	if claims.SessionID == uuid.Nil {
+		t.Fatal("Access token should carry a session ID")
+	}
+
+	sessions, _ := ListSessions(userID)
+	if len(sessions) != 1 || sessions[0].ID != claims.SessionID {
+		t.Fatalf("Expected one session %v, got %+v", claims.SessionID, sessions)
+	}
+	if sessions[0].UserAgent != client.UserAgent || sessions[0].IP != client.IP {
+		t.Errorf("Session should record the client, got %+v", sessions[0])
+	}
+
+	// Refreshing stays in the same session
+	refreshed, err := RefreshTokens(tokens.RefreshToken, client)
+	if err != nil {
+		t.Fatalf("RefreshTokens failed: %v", err)
+	}
+	if accessClaims(t, refreshed).SessionID != claims.SessionID {
+		t.Error("Refreshed tokens should keep the session ID")
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	userID := uuid.New()
+	tokens, _ := GenerateTokens(userID, ClientInfo{})
+	claims := accessClaims(t, tokens)
+
+	if err := RevokeSession(uuid.New(), claims.SessionID); err != ErrSessionNotFound {
+		t.Errorf("Another user must not revoke the session, got %v", err)
+	}
+
+	if err := RevokeSession(userID, claims.SessionID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+
+	if active, _ := sessionActive(claims); active {
+		t.Error("Access token should be rejected once its session is revoked")
+	}
+
+	if _, err := RefreshTokens(tokens.RefreshToken, ClientInfo{}); err != ErrTokenRevoked {
+		t.Errorf("Expected ErrTokenRevoked for the session's refresh token, got %v", err)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	userID := uuid.New()
+	current := accessClaims(t, mustGenerateTokens(t, userID))
+	other := accessClaims(t, mustGenerateTokens(t, userID))
+
+	if err := RevokeOtherSessions(userID, current.SessionID); err != nil {
+		t.Fatalf("RevokeOtherSessions failed: %v", err)
+	}
+
+	if active, _ := sessionActive(current); !active {
+		t.Error("Current session should stay signed in")
+	}
+	if active, _ := sessionActive(other); active {
+		t.Error("Other sessions should be signed out")
+	}
+}
+
+func TestSessionActive_LegacyToken(t *testing.T) {
+	if active, err := sessionActive(&Claims{UserID: uuid.New()}); err != nil || !active {
+		t.Errorf("Tokens without a session should be accepted, got %v, %v", active, err)
+	}
+
+	if active, _ := sessionActive(&Claims{UserID: uuid.New(), SessionID: uuid.New()}); active {
+		t.Error("Tokens for unknown sessions should be rejected")
+	}
+}
+
+func mustGenerateTokens(t *testing.T, userID uuid.UUID) *TokenPair {
+	t.Helper()
+	tokens, err := GenerateTokens(userID, ClientInfo{})
+	if err != nil {
+		t.Fatalf("GenerateTokens failed: %v", err)
+	}
+	return tokens
+}
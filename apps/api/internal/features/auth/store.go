@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// RefreshStore persists issued refresh tokens so they can be rotated and revoked
+type RefreshStore interface {
+	Create(token *models.RefreshToken) error
+	FindByHash(hash string) (*models.RefreshToken, error)
+	// MarkUsed flags a token as consumed. It reports false if the token was
+	// already used or revoked, so concurrent refreshes can't both succeed.
+	MarkUsed(id uuid.UUID, at time.Time) (bool, error)
+	RevokeFamily(familyID uuid.UUID, at time.Time) error
+	RevokeUser(userID uuid.UUID, at time.Time) error
+}
+
+var refreshStore RefreshStore = gormRefreshStore{}
+
+// SetRefreshStore replaces the store used for refresh tokens
+func SetRefreshStore(store RefreshStore) {
+	refreshStore = store
+}
+
+// hashToken returns the hex SHA-256 of a token, which is what we keep at rest
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type gormRefreshStore struct{}
+
+func (gormRefreshStore) Create(token *models.RefreshToken) error {
+	return database.DB.Create(token).Error
+}
+
+func (gormRefreshStore) FindByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := database.DB.Where("token_hash = ?", hash).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (gormRefreshStore) MarkUsed(id uuid.UUID, at time.Time) (bool, error) {
+	result := database.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", at)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (gormRefreshStore) RevokeFamily(familyID uuid.UUID, at time.Time) error {
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
+
+func (gormRefreshStore) RevokeUser(userID uuid.UUID, at time.Time) error {
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// memoryRefreshStore keeps refresh tokens in memory so token tests don't need a database
+type memoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]*models.RefreshToken
+}
+
+func newMemoryRefreshStore() *memoryRefreshStore {
+	return &memoryRefreshStore{tokens: make(map[uuid.UUID]*models.RefreshToken)}
+}
+
+func (s *memoryRefreshStore) Create(token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *token
+	s.tokens[token.ID] = &stored
+	return nil
+}
+
+func (s *memoryRefreshStore) FindByHash(hash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.TokenHash == hash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *memoryRefreshStore) MarkUsed(id uuid.UUID, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	token.UsedAt = &at
+	return true, nil
+}
+
+func (s *memoryRefreshStore) RevokeFamily(familyID uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *memoryRefreshStore) RevokeUser(userID uuid.UUID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	SetRefreshStore(newMemoryRefreshStore())
+	SetSessionStore(newMemorySessionStore())
+	SetChallengeStore(newMemoryChallengeStore())
+	SetNonceStore(newMemoryNonceStore())
+	throttles = newMemoryThrottleStore()
+	SetRoleStore(memoryRoleStore{})
+	audit.SetStore(auditEvents)
+	// Real costs make every password test slow
+	SetPasswordParams(PasswordParams{Memory: 8 * 1024, Time: 1, Threads: 1})
+	os.Exit(m.Run())
+}
+
+func TestRefreshTokens_Rotation(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	tokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+
+	rotated, err := RefreshTokens(tokens.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens failed: %v", err)
+	}
+
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Error("RefreshTokens should issue a new refresh token")
+	}
+
+	if _, err := RefreshTokens(rotated.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("Rotated refresh token should be usable: %v", err)
+	}
+}
+
+func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	tokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+	rotated, _ := RefreshTokens(tokens.RefreshToken, ClientInfo{})
+
+	// Replaying the consumed token is treated as theft
+	if _, err := RefreshTokens(tokens.RefreshToken, ClientInfo{}); err != ErrTokenReused {
+		t.Fatalf("Expected ErrTokenReused, got %v", err)
+	}
+
+	// ...and the legitimate holder's newer token dies with it
+	if _, err := RefreshTokens(rotated.RefreshToken, ClientInfo{}); err != ErrTokenRevoked {
+		t.Errorf("Expected ErrTokenRevoked for rest of family, got %v", err)
+	}
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	userID := uuid.New()
+	tokens, _ := GenerateTokens(userID, ClientInfo{})
+	other, _ := GenerateTokens(userID, ClientInfo{})
+
+	if err := RevokeRefreshToken(tokens.RefreshToken); err != nil {
+		t.Fatalf("RevokeRefreshToken failed: %v", err)
+	}
+
+	if _, err := RefreshTokens(tokens.RefreshToken, ClientInfo{}); err != ErrTokenRevoked {
+		t.Errorf("Expected ErrTokenRevoked after logout, got %v", err)
+	}
+
+	// Other logins for the same user are unaffected
+	if _, err := RefreshTokens(other.RefreshToken, ClientInfo{}); err != nil {
+		t.Errorf("Other family should still refresh: %v", err)
+	}
+
+	if err := RevokeRefreshToken("unknown-token"); err != ErrTokenNotFound {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+}
+
+func TestRefreshTokens_FixedClock(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	tokens, _ := GenerateTokens(uuid.New(), ClientInfo{})
+
+	clock = clock.Add(refreshTokenTTL - time.Minute)
+	rotated, err := RefreshTokens(tokens.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("Refresh token should be valid until refreshTokenTTL: %v", err)
+	}
+
+	clock = clock.Add(refreshTokenTTL + time.Second)
+	if _, err := RefreshTokens(rotated.RefreshToken, ClientInfo{}); err == nil {
+		t.Error("Refresh token should expire after refreshTokenTTL")
+	}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts")
+
+// LockoutError is returned while a login is locked out. It matches
+// ErrTooManyAttempts with errors.Is.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// throttlePolicy decides how long a key is locked after repeated failures
+type throttlePolicy struct {
+	// threshold is how many failures are allowed before the first lock
+	threshold int
+	// baseLock is the first lock, doubled for every failure after that
+	baseLock time.Duration
+	maxLock  time.Duration
+	// window is how long a failure is remembered
+	window time.Duration
+}
+
+var (
+	// accountPolicy protects one email against guesses from anywhere. It's
+	// generous because an attacker can trip it to lock the real user out.
+	accountPolicy = throttlePolicy{threshold: 10, baseLock: time.Minute, maxLock: time.Hour, window: 24 * time.Hour}
+	// emailIPPolicy stops a single client hammering one email
+	emailIPPolicy = throttlePolicy{threshold: 5, baseLock: 30 * time.Second, maxLock: 15 * time.Minute, window: time.Hour}
+	// mfaPolicy limits second-factor guesses per user. A six-digit code has
+	// far less entropy than a password, so it locks sooner.
+	mfaPolicy = throttlePolicy{threshold: 5, baseLock: time.Minute, maxLock: time.Hour, window: time.Hour}
+)
+
+func (p throttlePolicy) lockDuration(failures int) time.Duration {
+	if failures < p.threshold {
+		return 0
+	}
+
+	lock := p.baseLock
+	for i := p.threshold; i < failures && lock < p.maxLock; i++ {
+		lock *= 2
+	}
+
+	return min(lock, p.maxLock)
+}
+
+// countAttempt counts one attempt against row, locking it once the count
+// crosses the threshold. If row is already locked the attempt isn't counted,
+// and how long the lock has left is returned instead.
+func (p throttlePolicy) countAttempt(row *models.LoginThrottle, now time.Time) time.Duration {
+	if row.LockedUntil != nil && row.LockedUntil.After(now) {
+		return row.LockedUntil.Sub(now)
+	}
+
+	if now.Sub(row.LastFailureAt) > p.window {
+		row.Failures = 0
+	}
+
+	row.Failures++
+	row.LastFailureAt = now
+	if lock := p.lockDuration(row.Failures); lock > 0 {
+		until := now.Add(lock)
+		row.LockedUntil = &until
+	}
+
+	return 0
+}
+
+type throttleKey struct {
+	key    string
+	policy throttlePolicy
+}
+
+// loginThrottleKeys are the counters a login attempt is checked against.
+// They're keyed by the address typed, not the account, so unknown emails
+// lock out exactly like real ones and reveal nothing.
+func loginThrottleKeys(email, ip string) []throttleKey {
+	email = strings.ToLower(strings.TrimSpace(email))
+	return []throttleKey{
+		{key: "email:" + email, policy: accountPolicy},
+		{key: "email_ip:" + email + "|" + ip, policy: emailIPPolicy},
+	}
+}
+
+// passwordChangeThrottleKeys are the counters for checking the current
+// password when changing it. They're per user, so a stolen access token
+// can't be used to guess the password.
+func passwordChangeThrottleKeys(userID uuid.UUID) []throttleKey {
+	return []throttleKey{{key: "password_change:" + userID.String(), policy: emailIPPolicy}}
+}
+
+// mfaThrottleKeys are the counters for second-factor attempts. They're per
+// user, since the first factor has already identified them.
+func mfaThrottleKeys(userID uuid.UUID) []throttleKey {
+	return []throttleKey{{key: "mfa:" + userID.String(), policy: mfaPolicy}}
+}
+
+// throttleStore keeps the attempt counters
+type throttleStore interface {
+	// Attempt counts an attempt against key, or reports how long key is
+	// still locked. Checking and counting happen together, so a burst of
+	// parallel attempts can't all get in under the threshold.
+	Attempt(key string, policy throttlePolicy, now time.Time) (time.Duration, error)
+	Clear(keys []string) error
+	// Purge forgets keys that are unlocked and have no attempt since before
+	Purge(before, now time.Time) (int64, error)
+}
+
+var throttles throttleStore = gormThrottleStore{}
+
+type gormThrottleStore struct{}
+
+func (gormThrottleStore) Attempt(key string, policy throttlePolicy, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Make sure there's a row to lock without racing other first
+		// attempts to insert it
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Key: key}).Error
+		if err != nil {
+			return err
+		}
+
+		var row models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&row, "key = ?", key).Error; err != nil {
+			return err
+		}
+
+		if wait = policy.countAttempt(&row, now); wait > 0 {
+			return nil
+		}
+		return tx.Save(&row).Error
+	})
+	return wait, err
+}
+
+func (gormThrottleStore) Clear(keys []string) error {
+	return database.DB.Where("key IN ?", keys).Delete(&models.LoginThrottle{}).Error
+}
+
+func (gormThrottleStore) Purge(before, now time.Time) (int64, error) {
+	result := database.DB.
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)", before, now).
+		Delete(&models.LoginThrottle{})
+	return result.RowsAffected, result.Error
+}
+
+// throttleAttempt counts an attempt against every key before the secret is
+// checked, and fails with a LockoutError if any key is locked. Callers clear
+// the keys with clearLoginFailures once the attempt succeeds.
+func throttleAttempt(keys []throttleKey) error {
+	now := timeNow()
+
+	var wait time.Duration
+	for _, k := range keys {
+		left, err := throttles.Attempt(k.key, k.policy, now)
+		if err != nil {
+			return err
+		}
+		wait = max(wait, left)
+	}
+
+	if wait > 0 {
+		return &LockoutError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// clearLoginFailures forgets attempts after a successful login
+func clearLoginFailures(keys []throttleKey) error {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.key
+	}
+	return throttles.Clear(names)
+}
+
+// PurgeLoginThrottles deletes counters that no longer affect anything: no
+// lock left and no attempt within the longest policy window
+func PurgeLoginThrottles(now time.Time) (int64, error) {
+	return throttles.Purge(now.Add(-accountPolicy.window), now)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// equalizePasswordTiming spends as long as a real password check, for
+// logins where there's no hash to check against. Otherwise a fast reply
+// would reveal that the email isn't registered.
+func equalizePasswordTiming(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("parkshare-timing-equalizer")
+	})
+	CheckPassword(password, dummyHash)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// memoryThrottleStore keeps attempt counters in memory
+type memoryThrottleStore struct {
+	mu   sync.Mutex
+	rows map[string]*models.LoginThrottle
+}
+
+func newMemoryThrottleStore() *memoryThrottleStore {
+	return &memoryThrottleStore{rows: make(map[string]*models.LoginThrottle)}
+}
+
+func (s *memoryThrottleStore) Attempt(key string, policy throttlePolicy, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[key]
+	if !ok {
+		row = &models.LoginThrottle{Key: key}
+		s.rows[key] = row
+	}
+	return policy.countAttempt(row, now), nil
+}
+
+func (s *memoryThrottleStore) Clear(keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.rows, key)
+	}
+	return nil
+}
+
+func (s *memoryThrottleStore) Purge(before, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, row := range s.rows {
+		if row.LastFailureAt.Before(before) && (row.LockedUntil == nil || !row.LockedUntil.After(now)) {
+			delete(s.rows, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestThrottlePolicy_LockDuration(t *testing.T) {
+	policy := throttlePolicy{threshold: 5, baseLock: 30 * time.Second, maxLock: 15 * time.Minute, window: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 4, want: 0},
+		{failures: 5, want: 30 * time.Second},
+		{failures: 6, want: time.Minute},
+		{failures: 7, want: 2 * time.Minute},
+		{failures: 9, want: 8 * time.Minute},
+		{failures: 10, want: 15 * time.Minute},
+		{failures: 50, want: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.lockDuration(tt.failures); got != tt.want {
+			t.Errorf("lockDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleKeys_NormalizeEmail(t *testing.T) {
+	a := loginThrottleKeys("Host@Example.com ", "10.0.0.1")
+	b := loginThrottleKeys("host@example.com", "10.0.0.1")
+
+	for i := range a {
+		if a[i].key != b[i].key {
+			t.Errorf("Keys should ignore case and whitespace: %q vs %q", a[i].key, b[i].key)
+		}
+	}
+}
+
+func TestLockoutError_IsTooManyAttempts(t *testing.T) {
+	var err error = &LockoutError{RetryAfter: time.Minute}
+
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Error("LockoutError should match ErrTooManyAttempts")
+	}
+}
+
+func TestMFAThrottleKeys_PerUser(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	if mfaThrottleKeys(a)[0].key == mfaThrottleKeys(b)[0].key {
+		t.Error("Each user should have their own MFA throttle")
+	}
+}
+
+func TestThrottleAttempt_ParallelBurst(t *testing.T) {
+	keys := []throttleKey{{key: "burst:" + uuid.NewString(), policy: emailIPPolicy}}
+
+	// Every guess is counted before it's checked, so only the threshold's
+	// worth get through however many arrive at once
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if throttleAttempt(keys) == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != emailIPPolicy.threshold {
+		t.Errorf("%d attempts got through, want %d", allowed, emailIPPolicy.threshold)
+	}
+}
+
+func TestThrottleAttempt_ClearedOnSuccess(t *testing.T) {
+	keys := []throttleKey{{key: "clear:" + uuid.NewString(), policy: emailIPPolicy}}
+
+	for i := 0; i < emailIPPolicy.threshold-1; i++ {
+		throttleAttempt(keys)
+	}
+	clearLoginFailures(keys)
+
+	for i := 0; i < emailIPPolicy.threshold; i++ {
+		if err := throttleAttempt(keys); err != nil {
+			t.Fatalf("Attempt %d after a success should be allowed, got %v", i+1, err)
+		}
+	}
+	if err := throttleAttempt(keys); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected a lockout past the threshold, got %v", err)
+	}
+}
+
+func TestPurgeLoginThrottles(t *testing.T) {
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	stale := []throttleKey{{key: "stale:" + uuid.NewString(), policy: emailIPPolicy}}
+	throttleAttempt(stale)
+
+	clock = clock.Add(accountPolicy.window + time.Minute)
+	recent := []throttleKey{{key: "recent:" + uuid.NewString(), policy: emailIPPolicy}}
+	throttleAttempt(recent)
+
+	if _, err := PurgeLoginThrottles(clock); err != nil {
+		t.Fatalf("PurgeLoginThrottles failed: %v", err)
+	}
+
+	store := throttles.(*memoryThrottleStore)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.rows[stale[0].key]; ok {
+		t.Error("A key with no recent attempts should be purged")
+	}
+	if _, ok := store.rows[recent[0].key]; !ok {
+		t.Error("A key with recent attempts should be kept")
+	}
+}
+
+func TestChangePassword_LocksOutAfterFailures(t *testing.T) {
+	userID := uuid.New()
+
+	for i := 0; i < emailIPPolicy.threshold; i++ {
+		if err := throttleAttempt(passwordChangeThrottleKeys(userID)); err != nil {
+			t.Fatalf("Attempt %d should be allowed, got %v", i+1, err)
+		}
+	}
+
+	// Refused before the password is checked
+	_, err := ChangePassword(userID, "guess", "new-password-123", ClientInfo{})
+	if !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected a lockout, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rfcSecret is the RFC 6238 test key "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; ours are the last 6 digits of each
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(rfcSecret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("totpCode failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, _ := totpCode(rfcSecret, totpStep(now))
+
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{name: "current step", code: code, at: now, wantOK: true},
+		{name: "one step late", code: code, at: now.Add(totpPeriod * time.Second), wantOK: true},
+		{name: "one step early", code: code, at: now.Add(-totpPeriod * time.Second), wantOK: true},
+		{name: "two steps late", code: code, at: now.Add(2 * totpPeriod * time.Second), wantOK: false},
+		{name: "spaces ignored", code: code[:3] + " " + code[3:], at: now, wantOK: true},
+		{name: "wrong code", code: "000000", at: now, wantOK: false},
+		{name: "too short", code: code[:5], at: now, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := validateTOTP(rfcSecret, tt.code, tt.at)
+			if ok != tt.wantOK {
+				t.Errorf("validateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != totpStep(now) {
+				t.Errorf("validateTOTP() step = %d, want %d", step, totpStep(now))
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI(rfcSecret, "host@example.com")
+
+	for _, want := range []string{"otpauth://totp/ParkShare:host@example.com?", "secret=" + rfcSecret, "issuer=ParkShare", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI %q missing %q", uri, want)
+		}
+	}
+}
+
+func TestHashRecoveryCode_Normalizes(t *testing.T) {
+	code, _ := newRecoveryCode()
+
+	for _, typed := range []string{code, strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), strings.ReplaceAll(code, "-", " ")} {
+		if hashRecoveryCode(typed) != hashRecoveryCode(code) {
+			t.Errorf("hashRecoveryCode(%q) should match %q", typed, code)
+		}
+	}
+}
+
+func TestMFAChallenge_FixedClock(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	userID := uuid.New()
+	challenge, _ := issueMFAChallenge(userID)
+
+	claims, err := ValidateToken(challenge, TokenTypeMFA)
+	if err != nil {
+		t.Fatalf("Fresh challenge should validate: %v", err)
+	}
+	if claims.UserID != userID {
+		t.Errorf("UserID mismatch: got %v, want %v", claims.UserID, userID)
+	}
+
+	if _, err := ValidateToken(challenge, TokenTypeAccess); err == nil {
+		t.Error("An MFA challenge must not be usable as an access token")
+	}
+
+	clock = clock.Add(mfaChallengeTTL + time.Second)
+	if _, err := ValidateToken(challenge, TokenTypeMFA); err == nil {
+		t.Error("Challenge should expire after mfaChallengeTTL")
+	}
+}
+
+// memoryChallengeStore keeps MFA challenges in memory
+type memoryChallengeStore struct {
+	mu         sync.Mutex
+	challenges map[string]*mfaChallenge
+}
+
+type mfaChallenge struct {
+	userID    uuid.UUID
+	expiresAt time.Time
+	used      bool
+}
+
+func newMemoryChallengeStore() *memoryChallengeStore {
+	return &memoryChallengeStore{challenges: make(map[string]*mfaChallenge)}
+}
+
+func (s *memoryChallengeStore) Create(jti string, userID uuid.UUID, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[jti] = &mfaChallenge{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *memoryChallengeStore) Consume(jti string, userID uuid.UUID, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[jti]
+	if !ok || c.used || c.userID != userID || !at.Before(c.expiresAt) {
+		return false, nil
+	}
+	c.used = true
+	return true, nil
+}
+
+func TestMFAChallenge_SingleUse(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-for-testing")
+	defer os.Unsetenv("JWT_SECRET")
+
+	userID := uuid.New()
+	challenge, err := issueMFAChallenge(userID)
+	if err != nil {
+		t.Fatalf("issueMFAChallenge failed: %v", err)
+	}
+
+	claims, err := ValidateToken(challenge, TokenTypeMFA)
+	if err != nil {
+		t.Fatalf("Fresh challenge should validate: %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatal("Challenge should carry a jti")
+	}
+
+	if ok, _ := challengeStore.Consume(claims.ID, uuid.New(), timeNow()); ok {
+		t.Error("A challenge should not be redeemable for another user")
+	}
+	if ok, _ := challengeStore.Consume(claims.ID, userID, timeNow()); !ok {
+		t.Fatal("First use of a challenge should succeed")
+	}
+	if ok, _ := challengeStore.Consume(claims.ID, userID, timeNow()); ok {
+		t.Error("A challenge should only be usable once")
+	}
+}
+
+func TestDisableTOTP_LocksOutAfterFailures(t *testing.T) {
+	userID := uuid.New()
+
+	// Wrong codes that already went through use up the allowance...
+	for i := 0; i < mfaPolicy.threshold; i++ {
+		if err := throttleAttempt(mfaThrottleKeys(userID)); err != nil {
+			t.Fatalf("Attempt %d should be allowed, got %v", i+1, err)
+		}
+	}
+
+	// ...so the next one is refused before the code is even looked at
+	err := DisableTOTP(userID, "000000")
+	var lockout *LockoutError
+	if !errors.As(err, &lockout) || lockout.RetryAfter <= 0 {
+		t.Errorf("Expected a lockout, got %v", err)
+	}
+}
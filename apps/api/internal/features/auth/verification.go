@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/mail"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired token")
+
+const emailVerificationTTL = 24 * time.Hour
+
+// newSecret returns a random URL-safe token
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// frontendLink builds a link into the web app, e.g. for emails
+func frontendLink(path string, query url.Values) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path + "?" + query.Encode()
+}
+
+// issueVerificationToken creates a single-use token for purpose, replacing
+// any outstanding one so only the most recently sent link works
+func issueVerificationToken(userID uuid.UUID, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&models.VerificationToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.VerificationToken{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(secret),
+			ExpiresAt: timeNow().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// consumeVerificationToken redeems a token, failing if it is unknown,
+// expired, already used or meant for a different purpose
+func consumeVerificationToken(tx *gorm.DB, secret string, purpose models.TokenPurpose) (*models.VerificationToken, error) {
+	var token models.VerificationToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashToken(secret), purpose).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.UsedAt != nil || timeNow().After(token.ExpiresAt) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	result := tx.Model(&token).Where("used_at IS NULL").Update("used_at", timeNow())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	return &token, nil
+}
+
+// SendVerificationEmail emails the user a link to confirm their address
+func SendVerificationEmail(ctx context.Context, user *models.User) error {
+	secret, err := issueVerificationToken(user.ID, models.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := frontendLink("/auth/verify-email", url.Values{"token": {secret}})
+	return mail.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your ParkShare email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below. It expires in 24 hours.\n\n%s\n\nIf you didn't sign up for ParkShare you can ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// ResendVerificationEmail sends a fresh verification link. It reports
+// success for unknown or already verified addresses so it can't be used to
+// find out who has an account.
+func ResendVerificationEmail(ctx context.Context, email string) error {
+	var user models.User
+	err := database.DB.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if user.IsVerified {
+		return nil
+	}
+
+	return SendVerificationEmail(ctx, &user)
+}
+
+// ConfirmEmail redeems a verification token and marks the user verified
+func ConfirmEmail(secret string) (*models.User, error) {
+	var user models.User
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeVerificationToken(tx, secret, models.TokenPurposeEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, "id = ?", token.UserID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Update("is_verified", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
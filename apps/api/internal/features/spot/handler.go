@@ -3,7 +3,9 @@ package spot
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
 
+	"github.com/brandon-kong/parkshare/apps/api/internal/audit"
 	"github.com/brandon-kong/parkshare/apps/api/internal/database"
 	"github.com/brandon-kong/parkshare/apps/api/internal/features/auth"
 	"github.com/brandon-kong/parkshare/apps/api/internal/models"
@@ -11,14 +13,27 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// Routes serves spots. Mount it behind auth.OptionalMiddleware: browsing is
+// public, everything else needs a signed-in user.
 func Routes() chi.Router {
 	router := chi.NewRouter()
 
-	router.Get("/", List)
-    router.Post("/", Create)
+    router.Get("/search", Search)
+    router.Get("/map", Map)
     router.Get("/{id}", Get)
-    router.Put("/{id}", Update)
-    router.Delete("/{id}", Delete)
+
+    router.Group(func(r chi.Router) {
+        r.Use(auth.RequireAuth)
+
+        // The caller's own listings, including drafts
+        r.Get("/", List)
+        r.With(auth.RequirePermission(auth.PermSpotsWrite)).Post("/", Create)
+        r.Patch("/{id}", Update)
+        // Older clients send their partial updates with PUT
+        r.Put("/{id}", Update)
+        r.Delete("/{id}", Delete)
+        r.With(auth.RequireVerified).Post("/{id}/publish", Publish)
+    })
 
 	return router
 }
@@ -41,6 +56,15 @@ func Create(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if errs := validateCreateSpot(req); len(errs) > 0 {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error":  "Validation failed",
+            "fields": errs,
+        })
+        return
+    }
+    req.normalize()
+
     spot := &models.Spot{
         HostID:      claims.UserID,
         Title:       req.Title,
@@ -66,10 +90,13 @@ func Create(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    auth.Audit(r, audit.Entry{Action: audit.SpotCreated, TargetType: audit.TargetSpot, TargetID: spot.ID.String()})
+
     util.WriteJSON(w, http.StatusCreated, spot)
 }
 
 func Get(w http.ResponseWriter, r *http.Request) {
+    claims := auth.GetUserFromContext(r.Context())
     id := chi.URLParam(r, "id")
 
     var spot models.Spot
@@ -78,21 +105,74 @@ func Get(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // Anyone may view a live listing; drafts and the access instructions
+    // are only for the host
+    if !auth.SpotPolicy.Allows(claims, spot.HostID) {
+        if spot.Status != models.SpotStatusActive {
+            util.WriteError(w, http.StatusNotFound, "Spot not found")
+            return
+        }
+        spot.AccessInstructions = nil
+    }
+
     util.WriteJSON(w, http.StatusOK, spot)
 }
 
+// Search finds active spots near a point for renters
+func Search(w http.ResponseWriter, r *http.Request) {
+    params, errs := parseSearchParams(r.URL.Query())
+    if len(errs) > 0 {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error":  "Validation failed",
+            "fields": errs,
+        })
+        return
+    }
+
+    results, err := SearchNearby(params)
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to search spots")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, results)
+}
+
+// Map returns what a map viewport should show: spots when zoomed in,
+// clusters when zoomed out
+func Map(w http.ResponseWriter, r *http.Request) {
+    params, errs := parseMapParams(r.URL.Query())
+    if len(errs) > 0 {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error":  "Validation failed",
+            "fields": errs,
+        })
+        return
+    }
+
+    result, err := SearchMap(params)
+    if err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to load map")
+        return
+    }
+
+    util.WriteJSON(w, http.StatusOK, result)
+}
+
 func Update(w http.ResponseWriter, r *http.Request) {
     claims := auth.GetUserFromContext(r.Context())
     id := chi.URLParam(r, "id")
 
+    // Deleted spots are gone as far as editing goes
     var spot models.Spot
-    if err := database.DB.First(&spot, "id = ?", id).Error; err != nil {
+    if err := database.DB.First(&spot, "id = ? AND status <> ?", id, models.SpotStatusDeleted).Error; err != nil {
         util.WriteError(w, http.StatusNotFound, "Spot not found")
         return
     }
 
-    // Check ownership
-    if spot.HostID != claims.UserID {
+    // Owners, or admins acting on any spot
+    if !auth.SpotPolicy.Allows(claims, spot.HostID) {
+        auth.AuditDenied(r, audit.TargetSpot, spot.ID.String(), "not spot owner")
         util.WriteError(w, http.StatusForbidden, "You don't own this spot")
         return
     }
@@ -103,12 +183,48 @@ func Update(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Update fields
-    if err := database.DB.Model(&spot).Updates(req).Error; err != nil {
+    if errs := validateUpdateSpot(req); len(errs) > 0 {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error":  "Validation failed",
+            "fields": errs,
+        })
+        return
+    }
+
+    before := spot
+    updates := req.apply(&spot)
+    if !hasRate(spot.HourlyRate, spot.DailyRate, spot.MonthlyRate) {
+        util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+            "error":  "Validation failed",
+            "fields": map[string]string{"rates": missingRateMessage},
+        })
+        return
+    }
+
+    if len(updates) == 0 {
+        util.WriteJSON(w, http.StatusOK, spot)
+        return
+    }
+
+    if err := database.DB.Model(&spot).Updates(updates).Error; err != nil {
         util.WriteError(w, http.StatusInternalServerError, "Failed to update spot")
         return
     }
 
+    InvalidateTiles(before, spot)
+
+    fields := make([]string, 0, len(updates))
+    for column := range updates {
+        fields = append(fields, column)
+    }
+    slices.Sort(fields)
+    auth.Audit(r, audit.Entry{
+        Action:     audit.SpotUpdated,
+        TargetType: audit.TargetSpot,
+        TargetID:   spot.ID.String(),
+        Metadata:   map[string]interface{}{"fields": fields},
+    })
+
     util.WriteJSON(w, http.StatusOK, spot)
 }
 
@@ -122,18 +238,60 @@ func Delete(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Check ownership
-    if spot.HostID != claims.UserID {
+    // Owners, or admins acting on any spot
+    if !auth.SpotPolicy.Allows(claims, spot.HostID) {
+        auth.AuditDenied(r, audit.TargetSpot, spot.ID.String(), "not spot owner")
         util.WriteError(w, http.StatusForbidden, "You don't own this spot")
         return
     }
 
     // Soft delete - just change status
     database.DB.Model(&spot).Update("status", models.SpotStatusDeleted)
+    InvalidateTiles(spot)
+    auth.Audit(r, audit.Entry{Action: audit.SpotDeleted, TargetType: audit.TargetSpot, TargetID: spot.ID.String()})
 
     util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Spot deleted"})
 }
 
+func Publish(w http.ResponseWriter, r *http.Request) {
+    claims := auth.GetUserFromContext(r.Context())
+    id := chi.URLParam(r, "id")
+
+    var spot models.Spot
+    if err := database.DB.First(&spot, "id = ?", id).Error; err != nil {
+        util.WriteError(w, http.StatusNotFound, "Spot not found")
+        return
+    }
+
+    // Owners, or admins acting on any spot
+    if !auth.SpotPolicy.Allows(claims, spot.HostID) {
+        auth.AuditDenied(r, audit.TargetSpot, spot.ID.String(), "not spot owner")
+        util.WriteError(w, http.StatusForbidden, "You don't own this spot")
+        return
+    }
+
+    if spot.Status != models.SpotStatusDraft && spot.Status != models.SpotStatusPaused {
+        util.WriteError(w, http.StatusConflict, "Only draft or paused spots can be published")
+        return
+    }
+
+    if err := database.DB.Model(&spot).Update("status", models.SpotStatusActive).Error; err != nil {
+        util.WriteError(w, http.StatusInternalServerError, "Failed to publish spot")
+        return
+    }
+
+    InvalidateTiles(spot)
+
+    auth.Audit(r, audit.Entry{
+        Action:     audit.SpotUpdated,
+        TargetType: audit.TargetSpot,
+        TargetID:   spot.ID.String(),
+        Metadata:   map[string]interface{}{"status": models.SpotStatusActive},
+    })
+
+    util.WriteJSON(w, http.StatusOK, spot)
+}
+
 // Request types
 type CreateSpotRequest struct {
     Title       string           `json:"title"`
@@ -151,8 +309,3 @@ type CreateSpotRequest struct {
     DailyRate   *int             `json:"daily_rate"`
     MonthlyRate *int             `json:"monthly_rate"`
 }
-
-type UpdateSpotRequest struct {
-    Title       string `json:"title,omitempty"`
-    Description string `json:"description,omitempty"`
-}
\ No newline at end of file
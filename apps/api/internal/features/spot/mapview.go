@@ -0,0 +1,172 @@
+package spot
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	maxMapZoom = 22
+	// clusterBelowZoom is the zoom under which spots are grouped. From here
+	// in, a viewport is a few neighbourhoods at most.
+	clusterBelowZoom = 14
+	// clusterCellsPerTile splits each 256px map tile into cells of about
+	// 64px, one cluster per cell
+	clusterCellsPerTile = 4
+	// maxMapSpots caps the spots or clusters returned for one viewport
+	maxMapSpots = 500
+)
+
+// MapParams is a map viewport: a bounding box in degrees and a zoom level
+type MapParams struct {
+	West, South, East, North float64
+	Zoom                     int
+}
+
+// MapSpot is the little a map pin needs
+type MapSpot struct {
+	ID            uuid.UUID       `json:"id"`
+	Latitude      float64         `json:"latitude"`
+	Longitude     float64         `json:"longitude"`
+	SpotType      models.SpotType `json:"spot_type"`
+	IsCovered     bool            `json:"is_covered"`
+	HasEVCharging bool            `json:"has_ev_charging"`
+	HourlyRate    *int            `json:"hourly_rate,omitempty"`
+	DailyRate     *int            `json:"daily_rate,omitempty"`
+	MonthlyRate   *int            `json:"monthly_rate,omitempty"`
+}
+
+// Cluster stands in for every spot in one grid cell at low zoom
+type Cluster struct {
+	Count     int     `json:"count"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// SpotID is set when the cluster is a single spot
+	SpotID         *uuid.UUID `json:"spot_id,omitempty"`
+	MinHourlyRate  *int       `json:"min_hourly_rate,omitempty"`
+	MinDailyRate   *int       `json:"min_daily_rate,omitempty"`
+	MinMonthlyRate *int       `json:"min_monthly_rate,omitempty"`
+}
+
+// MapResult holds either spots or clusters, depending on zoom
+type MapResult struct {
+	Clustered bool      `json:"clustered"`
+	Spots     []MapSpot `json:"spots,omitempty"`
+	Clusters  []Cluster `json:"clusters,omitempty"`
+	// Truncated means the viewport had more than maxMapSpots spots or
+	// clusters, and only the first maxMapSpots are returned
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// parseMapParams reads bbox=west,south,east,north and zoom from a query
+// string, the same order Mapbox's getBounds().toArray() flattens to
+func parseMapParams(q url.Values) (MapParams, map[string]string) {
+	var params MapParams
+	errors := make(map[string]string)
+
+	parts := strings.Split(q.Get("bbox"), ",")
+	coords := make([]float64, 0, 4)
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(v) {
+			break
+		}
+		coords = append(coords, v)
+	}
+
+	switch {
+	case len(parts) != 4 || len(coords) != 4:
+		errors["bbox"] = "Must be west,south,east,north"
+	case checkLongitude(coords[0]) != "" || checkLongitude(coords[2]) != "":
+		errors["bbox"] = "Longitudes must be between -180 and 180"
+	case checkLatitude(coords[1]) != "" || checkLatitude(coords[3]) != "":
+		errors["bbox"] = "Latitudes must be between -90 and 90"
+	case coords[1] >= coords[3]:
+		errors["bbox"] = "South must be below north"
+	case coords[0] >= coords[2]:
+		// Viewports across the antimeridian are split by the client
+		errors["bbox"] = "West must be left of east"
+	default:
+		params.West, params.South, params.East, params.North = coords[0], coords[1], coords[2], coords[3]
+	}
+
+	zoom, err := strconv.Atoi(q.Get("zoom"))
+	if err != nil || zoom < 0 || zoom > maxMapZoom {
+		errors["zoom"] = "Must be a whole number between 0 and 22"
+	} else {
+		params.Zoom = zoom
+	}
+
+	return params, errors
+}
+
+// clustered reports whether a zoom level gets clusters instead of spots
+func (p MapParams) clustered() bool {
+	return p.Zoom < clusterBelowZoom
+}
+
+// clusterCellSize is the grid spacing in degrees for the zoom level
+func (p MapParams) clusterCellSize() float64 {
+	return 360 / math.Exp2(float64(p.Zoom)) / clusterCellsPerTile
+}
+
+// SearchMap returns the active spots in a viewport, grouped into clusters
+// when zoomed out
+func SearchMap(params MapParams) (*MapResult, error) {
+	// && compares bounding boxes, which the GiST index on location::geometry
+	// answers. The box stays planar: as geography its edges would be
+	// great-circle arcs, which turn inside out for viewports wider than 180°.
+	query := database.DB.Model(&models.Spot{}).
+		Where("status = ?", models.SpotStatusActive).
+		Where("location::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326)",
+			params.West, params.South, params.East, params.North)
+
+	if !params.clustered() {
+		var spots []MapSpot
+		err := query.
+			Select("id, latitude, longitude, spot_type, is_covered, has_ev_charging, hourly_rate, daily_rate, monthly_rate").
+			Order("id").
+			Limit(maxMapSpots + 1).
+			Scan(&spots).Error
+		if err != nil {
+			return nil, err
+		}
+
+		result := &MapResult{Spots: spots}
+		if len(spots) > maxMapSpots {
+			result.Spots = spots[:maxMapSpots]
+			result.Truncated = true
+		}
+		return result, nil
+	}
+
+	var clusters []Cluster
+	err := query.
+		Select(`COUNT(*) AS count,
+			ST_Y(ST_Centroid(ST_Collect(location::geometry))) AS latitude,
+			ST_X(ST_Centroid(ST_Collect(location::geometry))) AS longitude,
+			CASE WHEN COUNT(*) = 1 THEN (array_agg(id))[1] END AS spot_id,
+			MIN(hourly_rate) AS min_hourly_rate,
+			MIN(daily_rate) AS min_daily_rate,
+			MIN(monthly_rate) AS min_monthly_rate`).
+		Group("ST_SnapToGrid(location::geometry, " + strconv.FormatFloat(params.clusterCellSize(), 'g', -1, 64) + ")").
+		Order("count DESC").
+		Limit(maxMapSpots + 1).
+		Scan(&clusters).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MapResult{Clustered: true, Clusters: clusters}
+	if len(clusters) > maxMapSpots {
+		result.Clusters = clusters[:maxMapSpots]
+		result.Truncated = true
+	}
+	return result, nil
+}
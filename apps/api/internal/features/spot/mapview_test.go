@@ -0,0 +1,76 @@
+package spot
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseMapParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		want       MapParams
+		wantFields []string
+	}{
+		{
+			name:  "valid",
+			query: "bbox=-122.8,45.4,-122.5,45.6&zoom=12",
+			want:  MapParams{West: -122.8, South: 45.4, East: -122.5, North: 45.6, Zoom: 12},
+		},
+		{name: "missing", query: "", wantFields: []string{"bbox", "zoom"}},
+		{name: "three numbers", query: "bbox=1,2,3&zoom=5", wantFields: []string{"bbox"}},
+		{name: "not numbers", query: "bbox=a,b,c,d&zoom=5", wantFields: []string{"bbox"}},
+		{name: "longitude out of range", query: "bbox=-190,0,10,10&zoom=5", wantFields: []string{"bbox"}},
+		{name: "latitude out of range", query: "bbox=0,-95,10,10&zoom=5", wantFields: []string{"bbox"}},
+		{name: "south above north", query: "bbox=0,10,10,0&zoom=5", wantFields: []string{"bbox"}},
+		{name: "across the antimeridian", query: "bbox=170,0,-170,10&zoom=5", wantFields: []string{"bbox"}},
+		{name: "zoom too deep", query: "bbox=0,0,10,10&zoom=23", wantFields: []string{"zoom"}},
+		{name: "fractional zoom", query: "bbox=0,0,10,10&zoom=5.5", wantFields: []string{"zoom"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params, errs := parseMapParams(q)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("errors = %v, want fields %v", errs, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("missing error for %s in %v", field, errs)
+				}
+			}
+			if len(tt.wantFields) == 0 && params != tt.want {
+				t.Errorf("params = %+v, want %+v", params, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapParams_Clustering(t *testing.T) {
+	tests := []struct {
+		zoom          int
+		wantClustered bool
+		wantCellSize  float64
+	}{
+		{zoom: 0, wantClustered: true, wantCellSize: 90},
+		{zoom: 10, wantClustered: true, wantCellSize: 360.0 / 1024 / 4},
+		{zoom: clusterBelowZoom - 1, wantClustered: true, wantCellSize: 360.0 / 8192 / 4},
+		{zoom: clusterBelowZoom, wantClustered: false},
+		{zoom: maxMapZoom, wantClustered: false},
+	}
+
+	for _, tt := range tests {
+		params := MapParams{Zoom: tt.zoom}
+		if got := params.clustered(); got != tt.wantClustered {
+			t.Errorf("zoom %d: clustered = %v, want %v", tt.zoom, got, tt.wantClustered)
+		}
+		if tt.wantClustered && params.clusterCellSize() != tt.wantCellSize {
+			t.Errorf("zoom %d: cell size = %v, want %v", tt.zoom, params.clusterCellSize(), tt.wantCellSize)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package spot
+
+import (
+	"strings"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+)
+
+// UpdateSpotRequest is a partial update. Fields left out stay as they are;
+// access instructions and rates can be cleared with null.
+type UpdateSpotRequest struct {
+	Title              util.Optional[string]             `json:"title"`
+	Description        util.Optional[string]             `json:"description"`
+	Address            util.Optional[string]             `json:"address"`
+	City               util.Optional[string]             `json:"city"`
+	State              util.Optional[string]             `json:"state"`
+	PostalCode         util.Optional[string]             `json:"postal_code"`
+	Country            util.Optional[string]             `json:"country"`
+	Latitude           util.Optional[float64]            `json:"latitude"`
+	Longitude          util.Optional[float64]            `json:"longitude"`
+	SpotType           util.Optional[models.SpotType]    `json:"spot_type"`
+	VehicleSize        util.Optional[models.VehicleSize] `json:"vehicle_size"`
+	IsCovered          util.Optional[bool]               `json:"is_covered"`
+	HasEVCharging      util.Optional[bool]               `json:"has_ev_charging"`
+	HasSecurity        util.Optional[bool]               `json:"has_security"`
+	AccessInstructions util.Optional[string]             `json:"access_instructions"`
+	HourlyRate         util.Optional[int]                `json:"hourly_rate"`
+	DailyRate          util.Optional[int]                `json:"daily_rate"`
+	MonthlyRate        util.Optional[int]                `json:"monthly_rate"`
+}
+
+func validateUpdateSpot(req UpdateSpotRequest) map[string]string {
+	errors := make(map[string]string)
+
+	checkOptional(errors, "title", req.Title, false, func(v string) string { return checkRequired(v, maxTitleLength) })
+	checkOptional(errors, "description", req.Description, false, func(v string) string { return checkLength(v, maxDescriptionLength) })
+	checkOptional(errors, "address", req.Address, false, func(v string) string { return checkRequired(v, maxAddressLength) })
+	checkOptional(errors, "city", req.City, false, func(v string) string { return checkRequired(v, maxCityLength) })
+	checkOptional(errors, "state", req.State, false, func(v string) string { return checkLength(v, maxStateLength) })
+	checkOptional(errors, "postal_code", req.PostalCode, false, func(v string) string { return checkLength(v, maxPostalCodeLength) })
+	checkOptional(errors, "country", req.Country, false, checkCountry)
+	checkOptional(errors, "latitude", req.Latitude, false, checkLatitude)
+	checkOptional(errors, "longitude", req.Longitude, false, checkLongitude)
+	checkOptional(errors, "spot_type", req.SpotType, false, checkSpotType)
+	checkOptional(errors, "vehicle_size", req.VehicleSize, false, checkVehicleSize)
+	checkOptional(errors, "is_covered", req.IsCovered, false, nil)
+	checkOptional(errors, "has_ev_charging", req.HasEVCharging, false, nil)
+	checkOptional(errors, "has_security", req.HasSecurity, false, nil)
+	checkOptional(errors, "access_instructions", req.AccessInstructions, true, func(v string) string {
+		return checkLength(v, maxAccessInstructionsLength)
+	})
+	checkOptional(errors, "hourly_rate", req.HourlyRate, true, checkRate)
+	checkOptional(errors, "daily_rate", req.DailyRate, true, checkRate)
+	checkOptional(errors, "monthly_rate", req.MonthlyRate, true, checkRate)
+
+	return errors
+}
+
+// checkOptional records a problem with a field that was sent, if it has one
+func checkOptional[T any](errors map[string]string, field string, value util.Optional[T], nullable bool, check func(T) string) {
+	if !value.Set {
+		return
+	}
+	if value.Null {
+		if !nullable {
+			errors[field] = "Cannot be null"
+		}
+		return
+	}
+	if check == nil {
+		return
+	}
+	if msg := check(value.Value); msg != "" {
+		errors[field] = msg
+	}
+}
+
+// apply writes a validated update onto spot and returns the changed columns.
+// Moving the spot recomputes its location.
+func (req UpdateSpotRequest) apply(spot *models.Spot) map[string]interface{} {
+	updates := make(map[string]interface{})
+
+	setString := func(column string, field util.Optional[string], dest *string) {
+		if field.Set {
+			*dest = strings.TrimSpace(field.Value)
+			updates[column] = *dest
+		}
+	}
+	setString("title", req.Title, &spot.Title)
+	setString("description", req.Description, &spot.Description)
+	setString("address", req.Address, &spot.Address)
+	setString("city", req.City, &spot.City)
+	setString("state", req.State, &spot.State)
+	setString("postal_code", req.PostalCode, &spot.PostalCode)
+
+	if req.Country.Set {
+		spot.Country = strings.ToUpper(strings.TrimSpace(req.Country.Value))
+		updates["country"] = spot.Country
+	}
+
+	if req.Latitude.Set || req.Longitude.Set {
+		if req.Latitude.Set {
+			spot.Latitude = req.Latitude.Value
+			updates["latitude"] = spot.Latitude
+		}
+		if req.Longitude.Set {
+			spot.Longitude = req.Longitude.Value
+			updates["longitude"] = spot.Longitude
+		}
+		spot.Location = models.NewGeoPoint(spot.Longitude, spot.Latitude)
+		updates["location"] = spot.Location
+	}
+
+	if req.SpotType.Set {
+		spot.SpotType = req.SpotType.Value
+		updates["spot_type"] = spot.SpotType
+	}
+	if req.VehicleSize.Set {
+		spot.VehicleSize = req.VehicleSize.Value
+		updates["vehicle_size"] = spot.VehicleSize
+	}
+
+	setBool := func(column string, field util.Optional[bool], dest *bool) {
+		if field.Set {
+			*dest = field.Value
+			updates[column] = *dest
+		}
+	}
+	setBool("is_covered", req.IsCovered, &spot.IsCovered)
+	setBool("has_ev_charging", req.HasEVCharging, &spot.HasEVCharging)
+	setBool("has_security", req.HasSecurity, &spot.HasSecurity)
+
+	if req.AccessInstructions.Set {
+		spot.AccessInstructions = req.AccessInstructions.Ptr()
+		if spot.AccessInstructions != nil {
+			trimmed := strings.TrimSpace(*spot.AccessInstructions)
+			spot.AccessInstructions = &trimmed
+		}
+		updates["access_instructions"] = spot.AccessInstructions
+	}
+
+	setRate := func(column string, field util.Optional[int], dest **int) {
+		if field.Set {
+			*dest = field.Ptr()
+			updates[column] = *dest
+		}
+	}
+	setRate("hourly_rate", req.HourlyRate, &spot.HourlyRate)
+	setRate("daily_rate", req.DailyRate, &spot.DailyRate)
+	setRate("monthly_rate", req.MonthlyRate, &spot.MonthlyRate)
+
+	return updates
+}
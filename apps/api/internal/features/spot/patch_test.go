@@ -0,0 +1,123 @@
+package spot
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+)
+
+func decodeUpdate(t *testing.T, body string) UpdateSpotRequest {
+	t.Helper()
+	var req UpdateSpotRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	return req
+}
+
+func TestValidateUpdateSpot(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []string
+	}{
+		{name: "empty patch", body: `{}`},
+		{name: "valid changes", body: `{"title":"Covered driveway","latitude":45.5,"longitude":-122.6,"spot_type":"garage","hourly_rate":350}`},
+		{name: "clear nullable fields", body: `{"access_instructions":null,"daily_rate":null}`},
+		{name: "null title", body: `{"title":null}`, wantFields: []string{"title"}},
+		{name: "blank title", body: `{"title":"   "}`, wantFields: []string{"title"}},
+		{name: "long description", body: `{"description":"` + strings.Repeat("a", maxDescriptionLength+1) + `"}`, wantFields: []string{"description"}},
+		{name: "latitude out of range", body: `{"latitude":500}`, wantFields: []string{"latitude"}},
+		{name: "longitude out of range", body: `{"longitude":-181}`, wantFields: []string{"longitude"}},
+		{name: "unknown spot type", body: `{"spot_type":"helipad"}`, wantFields: []string{"spot_type"}},
+		{name: "unknown vehicle size", body: `{"vehicle_size":"tank"}`, wantFields: []string{"vehicle_size"}},
+		{name: "negative rate", body: `{"monthly_rate":-1}`, wantFields: []string{"monthly_rate"}},
+		{name: "null amenity", body: `{"is_covered":null}`, wantFields: []string{"is_covered"}},
+		{name: "bad country", body: `{"country":"USA"}`, wantFields: []string{"country"}},
+		{
+			name:       "several problems",
+			body:       `{"city":"","latitude":-91,"hourly_rate":-5}`,
+			wantFields: []string{"city", "latitude", "hourly_rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateUpdateSpot(decodeUpdate(t, tt.body))
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("errors = %v, want fields %v", errs, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("missing error for %s in %v", field, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateSpotRequest_Apply(t *testing.T) {
+	rate := 500
+	instructions := "Gate code 1234"
+	newSpot := func() *models.Spot {
+		return &models.Spot{
+			Title:              "Driveway",
+			City:               "Portland",
+			Latitude:           45.5,
+			Longitude:          -122.6,
+			Location:           models.NewGeoPoint(-122.6, 45.5),
+			IsCovered:          true,
+			AccessInstructions: &instructions,
+			HourlyRate:         &rate,
+			DailyRate:          &rate,
+		}
+	}
+
+	t.Run("absent fields are untouched", func(t *testing.T) {
+		spot := newSpot()
+		updates := decodeUpdate(t, `{"title":"  Garage  "}`).apply(spot)
+
+		if len(updates) != 1 || updates["title"] != "Garage" {
+			t.Errorf("updates = %v, want only the trimmed title", updates)
+		}
+		if spot.City != "Portland" || spot.HourlyRate == nil {
+			t.Error("fields not in the patch should keep their values")
+		}
+	})
+
+	t.Run("null clears and false is kept", func(t *testing.T) {
+		spot := newSpot()
+		updates := decodeUpdate(t, `{"access_instructions":null,"hourly_rate":null,"is_covered":false}`).apply(spot)
+
+		if spot.AccessInstructions != nil || spot.HourlyRate != nil {
+			t.Error("null should clear the field")
+		}
+		if spot.DailyRate == nil {
+			t.Error("daily rate wasn't in the patch")
+		}
+		if v, ok := updates["is_covered"]; !ok || v != false {
+			t.Errorf("is_covered update = %v, want false", v)
+		}
+	})
+
+	t.Run("moving recomputes location", func(t *testing.T) {
+		spot := newSpot()
+		updates := decodeUpdate(t, `{"latitude":47.6}`).apply(spot)
+
+		if _, ok := updates["location"]; !ok {
+			t.Fatal("expected location to be updated")
+		}
+		if spot.Location.Lat() != 47.6 || spot.Location.Lng() != -122.6 {
+			t.Errorf("location = (%v, %v), want (47.6, -122.6)", spot.Location.Lat(), spot.Location.Lng())
+		}
+	})
+
+	t.Run("other changes leave location alone", func(t *testing.T) {
+		updates := decodeUpdate(t, `{"city":"Seattle"}`).apply(newSpot())
+		if _, ok := updates["location"]; ok {
+			t.Error("location should only change when coordinates do")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package spot
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSearchRadius = 1000
+	minSearchRadius     = 1
+	maxSearchRadius     = 50000
+	defaultSearchLimit  = 50
+	maxSearchLimit      = 200
+)
+
+// SearchParams finds active spots within RadiusM meters of a point
+type SearchParams struct {
+	Lat     float64
+	Lng     float64
+	RadiusM float64
+	Limit   int
+}
+
+// SearchResult is a spot and how far it is from the search point
+type SearchResult struct {
+	models.Spot
+	DistanceM float64 `json:"distance_m"`
+}
+
+// parseSearchParams reads lat, lng, radius_m and limit from a query string
+func parseSearchParams(q url.Values) (SearchParams, map[string]string) {
+	params := SearchParams{RadiusM: defaultSearchRadius, Limit: defaultSearchLimit}
+	errors := make(map[string]string)
+
+	parseCoord := func(name string, check func(float64) string, dest *float64) {
+		raw := q.Get(name)
+		if raw == "" {
+			errors[name] = "Required"
+			return
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			errors[name] = "Must be a number"
+			return
+		}
+		if msg := check(v); msg != "" {
+			errors[name] = msg
+			return
+		}
+		*dest = v
+	}
+	parseCoord("lat", checkLatitude, &params.Lat)
+	parseCoord("lng", checkLongitude, &params.Lng)
+
+	if raw := q.Get("radius_m"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(v) || v < minSearchRadius || v > maxSearchRadius {
+			errors["radius_m"] = "Must be between 1 and 50000"
+		} else {
+			params.RadiusM = v
+		}
+	}
+
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			errors["limit"] = "Must be between 1 and 200"
+		} else {
+			params.Limit = n
+		}
+	}
+
+	return params, errors
+}
+
+// SearchNearby returns active spots within the radius, nearest first
+func SearchNearby(params SearchParams) ([]SearchResult, error) {
+	type hit struct {
+		ID        uuid.UUID
+		DistanceM float64
+	}
+
+	// Distances are computed on the geography column so they're in meters,
+	// and ST_DWithin lets the GiST index on location do the filtering
+	var hits []hit
+	err := database.DB.Raw(`
+		SELECT spots.id, ST_Distance(spots.location, origin.point) AS distance_m
+		FROM spots
+		CROSS JOIN (SELECT ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography AS point) AS origin
+		WHERE spots.status = ? AND ST_DWithin(spots.location, origin.point, ?)
+		ORDER BY distance_m, spots.id
+		LIMIT ?`,
+		params.Lng, params.Lat, models.SpotStatusActive, params.RadiusM, params.Limit,
+	).Scan(&hits).Error
+	if err != nil || len(hits) == 0 {
+		return []SearchResult{}, err
+	}
+
+	ids := make([]uuid.UUID, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+
+	var spots []models.Spot
+	if err := database.DB.Preload("Photos").Where("id IN ?", ids).Find(&spots).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]models.Spot, len(spots))
+	for _, spot := range spots {
+		byID[spot.ID] = spot
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, h := range hits {
+		spot, ok := byID[h.ID]
+		if !ok {
+			continue
+		}
+		// Only the host and their renters get these
+		spot.AccessInstructions = nil
+		results = append(results, SearchResult{Spot: spot, DistanceM: h.DistanceM})
+	}
+
+	return results, nil
+}
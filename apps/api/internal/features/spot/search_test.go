@@ -0,0 +1,57 @@
+package spot
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSearchParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		want       SearchParams
+		wantFields []string
+	}{
+		{
+			name:  "defaults",
+			query: "lat=45.52&lng=-122.68",
+			want:  SearchParams{Lat: 45.52, Lng: -122.68, RadiusM: defaultSearchRadius, Limit: defaultSearchLimit},
+		},
+		{
+			name:  "radius and limit",
+			query: "lat=45.52&lng=-122.68&radius_m=2500&limit=10",
+			want:  SearchParams{Lat: 45.52, Lng: -122.68, RadiusM: 2500, Limit: 10},
+		},
+		{name: "missing point", query: "", wantFields: []string{"lat", "lng"}},
+		{name: "not a number", query: "lat=north&lng=-122.68", wantFields: []string{"lat"}},
+		{name: "latitude out of range", query: "lat=91&lng=0", wantFields: []string{"lat"}},
+		{name: "longitude out of range", query: "lat=0&lng=181", wantFields: []string{"lng"}},
+		{name: "zero radius", query: "lat=1&lng=1&radius_m=0", wantFields: []string{"radius_m"}},
+		{name: "radius under a meter", query: "lat=1&lng=1&radius_m=0.5", wantFields: []string{"radius_m"}},
+		{name: "radius too large", query: "lat=1&lng=1&radius_m=50001", wantFields: []string{"radius_m"}},
+		{name: "NaN radius", query: "lat=1&lng=1&radius_m=NaN", wantFields: []string{"radius_m"}},
+		{name: "limit too large", query: "lat=1&lng=1&limit=500", wantFields: []string{"limit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params, errs := parseSearchParams(q)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("errors = %v, want fields %v", errs, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("missing error for %s in %v", field, errs)
+				}
+			}
+			if len(tt.wantFields) == 0 && params != tt.want {
+				t.Errorf("params = %+v, want %+v", params, tt.want)
+			}
+		})
+	}
+}
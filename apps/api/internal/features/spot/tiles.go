@@ -0,0 +1,282 @@
+package spot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/go-chi/chi/v5"
+)
+
+var ErrInvalidTile = errors.New("invalid tile coordinates")
+
+const (
+	// tileContentType is the registered media type for Mapbox Vector Tiles
+	tileContentType = "application/vnd.mapbox-vector-tile"
+	// tileCacheControl keeps tiles fresh to within a minute for browsers and
+	// CDNs, which revalidate with the ETag after that
+	tileCacheControl = "public, max-age=60, stale-while-revalidate=300"
+	// maxCachedTiles bounds the tiles kept in memory
+	maxCachedTiles = 10000
+
+	maxMercatorLatitude = 85.05112878
+	// tileBuffer is how far past its edges, in tiles, a tile draws points:
+	// ST_AsMVTGeom's default 256 of 4096 extent units
+	tileBuffer = 256.0 / 4096
+)
+
+// TileCoord is a tile in the XYZ scheme Mapbox uses
+type TileCoord struct {
+	Z, X, Y int
+}
+
+// parseTileCoord reads a tile's coordinates from URL parameters
+func parseTileCoord(z, x, y string) (TileCoord, error) {
+	var tile TileCoord
+	var err error
+
+	if tile.Z, err = strconv.Atoi(z); err != nil || tile.Z < 0 || tile.Z > maxMapZoom {
+		return tile, ErrInvalidTile
+	}
+
+	n := 1 << tile.Z
+	if tile.X, err = strconv.Atoi(x); err != nil || tile.X < 0 || tile.X >= n {
+		return tile, ErrInvalidTile
+	}
+	if tile.Y, err = strconv.Atoi(y); err != nil || tile.Y < 0 || tile.Y >= n {
+		return tile, ErrInvalidTile
+	}
+
+	return tile, nil
+}
+
+// tilePosition returns where a point falls at zoom z, in fractional tiles
+func tilePosition(lat, lng float64, z int) (x, y float64) {
+	// Web Mercator stops short of the poles
+	lat = max(-maxMercatorLatitude, min(maxMercatorLatitude, lat))
+	n := math.Exp2(float64(z))
+	latRad := lat * math.Pi / 180
+
+	x = (lng + 180) / 360 * n
+	y = (1 - math.Log(math.Tan(latRad)+1/math.Cos(latRad))/math.Pi) / 2 * n
+	return x, y
+}
+
+// tileAt returns the tile at zoom z holding a fractional tile position.
+// Positions on the far edges belong to the last tile, not one past it.
+func tileAt(x, y float64, z int) TileCoord {
+	n := 1 << z
+	clamp := func(v float64) int {
+		return max(0, min(n-1, int(math.Floor(v))))
+	}
+	return TileCoord{Z: z, X: clamp(x), Y: clamp(y)}
+}
+
+// tileContaining returns the tile a point falls in at zoom z
+func tileContaining(lat, lng float64, z int) TileCoord {
+	x, y := tilePosition(lat, lng, z)
+	return tileAt(x, y, z)
+}
+
+// tileBounds returns the tile's edges in degrees. The top and bottom rows
+// reach the poles, since tileContaining puts polar points in them.
+func tileBounds(tile TileCoord) (west, south, east, north float64) {
+	n := math.Exp2(float64(tile.Z))
+	lat := func(y int) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+	}
+
+	west = float64(tile.X)/n*360 - 180
+	east = float64(tile.X+1)/n*360 - 180
+	north, south = lat(tile.Y), lat(tile.Y+1)
+	if tile.Y == 0 {
+		north = 90
+	}
+	if tile.Y == int(n)-1 {
+		south = -90
+	}
+	return west, south, east, north
+}
+
+// tilesNear returns the tiles at zoom z that draw a point: the one it falls
+// in, plus any neighbour whose buffer reaches it
+func tilesNear(lat, lng float64, z int) []TileCoord {
+	x, y := tilePosition(lat, lng, z)
+
+	var near []TileCoord
+	for _, dx := range []float64{-tileBuffer, 0, tileBuffer} {
+		for _, dy := range []float64{-tileBuffer, 0, tileBuffer} {
+			tile := tileAt(x+dx, y+dy, z)
+			if !slices.Contains(near, tile) {
+				near = append(near, tile)
+			}
+		}
+	}
+	return near
+}
+
+type cachedTile struct {
+	data []byte
+	etag string
+}
+
+// tileCache holds rendered tiles until a spot inside them changes. It lives
+// in this process only: with several API instances each keeps its own copy,
+// and a change invalidates tiles only on the instance that made it. Other
+// instances catch up as their tiles are evicted or they restart.
+type tileCache struct {
+	mu    sync.RWMutex
+	tiles map[TileCoord]cachedTile
+	// generation counts invalidations, so a render that raced one isn't
+	// cached
+	generation uint64
+}
+
+func newTileCache() *tileCache {
+	return &tileCache{tiles: make(map[TileCoord]cachedTile)}
+}
+
+var tiles = newTileCache()
+
+func (c *tileCache) get(tile TileCoord) (cachedTile, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cached, ok := c.tiles[tile]
+	return cached, ok
+}
+
+// currentGeneration is snapshotted before rendering and passed to put
+func (c *tileCache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// put caches a tile rendered at generation. If tiles were invalidated since,
+// the render may predate the change, so it's returned but not kept.
+func (c *tileCache) put(tile TileCoord, data []byte, generation uint64) cachedTile {
+	sum := sha256.Sum256(data)
+	cached := cachedTile{data: data, etag: `"` + hex.EncodeToString(sum[:16]) + `"`}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return cached
+	}
+	if len(c.tiles) >= maxCachedTiles {
+		// Dropping an arbitrary tile only costs a re-render
+		for key := range c.tiles {
+			delete(c.tiles, key)
+			break
+		}
+	}
+	c.tiles[tile] = cached
+	return cached
+}
+
+// invalidatePoint drops every cached tile, at every zoom, that shows a point
+func (c *tileCache) invalidatePoint(lat, lng float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for z := 0; z <= maxMapZoom; z++ {
+		for _, tile := range tilesNear(lat, lng, z) {
+			delete(c.tiles, tile)
+		}
+	}
+}
+
+func (c *tileCache) invalidate(spots ...models.Spot) {
+	for _, spot := range spots {
+		c.invalidatePoint(spot.Latitude, spot.Longitude)
+	}
+}
+
+// InvalidateTiles drops the cached tiles showing any of the spots. Pass a
+// moved spot's old and new state.
+func InvalidateTiles(spots ...models.Spot) {
+	tiles.invalidate(spots...)
+}
+
+// renderTile builds a vector tile of the active spots in it, with one layer
+// named "spots"
+func renderTile(tile TileCoord) ([]byte, error) {
+	// The filter is a planar lon/lat box on the indexed location::geometry.
+	// As geography its edges would be great-circle arcs, and the low zoom
+	// tiles, which span half the world or more, would come out inside out.
+	west, south, east, north := tileBounds(tile)
+
+	var data []byte
+	err := database.DB.Raw(`
+		WITH bounds AS (
+			SELECT ST_TileEnvelope(?, ?, ?) AS geom
+		),
+		features AS (
+			SELECT
+				ST_AsMVTGeom(ST_Transform(spots.location::geometry, 3857), bounds.geom) AS geom,
+				spots.id::text AS id,
+				spots.spot_type,
+				spots.hourly_rate,
+				spots.daily_rate,
+				spots.monthly_rate,
+				spots.is_covered,
+				spots.has_ev_charging
+			FROM spots, bounds
+			WHERE spots.status = ?
+				AND spots.location::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326)
+		)
+		SELECT ST_AsMVT(features, 'spots', 4096, 'geom') FROM features`,
+		tile.Z, tile.X, tile.Y, models.SpotStatusActive, west, south, east, north,
+	).Row().Scan(&data)
+	return data, err
+}
+
+// Tile serves the spots layer as a Mapbox Vector Tile
+func Tile(w http.ResponseWriter, r *http.Request) {
+	tiles.serve(w, r)
+}
+
+func (c *tileCache) serve(w http.ResponseWriter, r *http.Request) {
+	tile, err := parseTileCoord(chi.URLParam(r, "z"), chi.URLParam(r, "x"), chi.URLParam(r, "y"))
+	if err != nil {
+		util.WriteError(w, http.StatusNotFound, "Tile not found")
+		return
+	}
+
+	cached, ok := c.get(tile)
+	if !ok {
+		generation := c.currentGeneration()
+		data, err := renderTile(tile)
+		if err != nil {
+			util.WriteError(w, http.StatusInternalServerError, "Failed to render tile")
+			return
+		}
+		cached = c.put(tile, data, generation)
+	}
+
+	w.Header().Set("Cache-Control", tileCacheControl)
+	w.Header().Set("ETag", cached.etag)
+
+	if r.Header.Get("If-None-Match") == cached.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Mapbox treats an empty response as a tile with nothing in it
+	if len(cached.data) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", tileContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(cached.data)))
+	w.Write(cached.data)
+}
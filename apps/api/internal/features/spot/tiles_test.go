@@ -0,0 +1,225 @@
+package spot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestParseTileCoord(t *testing.T) {
+	tests := []struct {
+		name    string
+		z, x, y string
+		want    TileCoord
+		wantErr bool
+	}{
+		{name: "world", z: "0", x: "0", y: "0", want: TileCoord{0, 0, 0}},
+		{name: "city", z: "12", x: "654", y: "1464", want: TileCoord{12, 654, 1464}},
+		{name: "x past the edge", z: "1", x: "2", y: "0", wantErr: true},
+		{name: "negative y", z: "3", x: "0", y: "-1", wantErr: true},
+		{name: "zoom too deep", z: "23", x: "0", y: "0", wantErr: true},
+		{name: "not a number", z: "a", x: "0", y: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTileCoord(tt.z, tt.x, tt.y)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTileCoord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseTileCoord() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTileContaining(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		z        int
+		want     TileCoord
+	}{
+		{name: "world", lat: 45.5, lng: -122.6, z: 0, want: TileCoord{0, 0, 0}},
+		{name: "north east quadrant", lat: 0.1, lng: 0.1, z: 1, want: TileCoord{1, 1, 0}},
+		{name: "south west quadrant", lat: -0.1, lng: -0.1, z: 1, want: TileCoord{1, 0, 1}},
+		{name: "portland", lat: 45.5152, lng: -122.6784, z: 12, want: TileCoord{12, 652, 1465}},
+		{name: "pole and antimeridian", lat: 90, lng: 180, z: 2, want: TileCoord{2, 3, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tileContaining(tt.lat, tt.lng, tt.z); got != tt.want {
+				t.Errorf("tileContaining() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTileBounds_World(t *testing.T) {
+	west, south, east, north := tileBounds(TileCoord{0, 0, 0})
+
+	// Spots at the edge of each hemisphere all belong in tile 0/0/0
+	edges := []struct {
+		name     string
+		lat, lng float64
+	}{
+		{name: "far west", lat: 0, lng: -179.99},
+		{name: "far east", lat: 0, lng: 179.99},
+		{name: "far north", lat: 85, lng: 0},
+		{name: "far south", lat: -85, lng: 0},
+		{name: "north east corner", lat: 89.9, lng: 180},
+		{name: "south west corner", lat: -89.9, lng: -180},
+	}
+
+	for _, e := range edges {
+		t.Run(e.name, func(t *testing.T) {
+			if e.lng < west || e.lng > east || e.lat < south || e.lat > north {
+				t.Errorf("(%v, %v) outside world tile bounds %v,%v,%v,%v", e.lat, e.lng, west, south, east, north)
+			}
+			if got := tileContaining(e.lat, e.lng, 0); got != (TileCoord{0, 0, 0}) {
+				t.Errorf("tileContaining() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestTileBounds_MatchTileContaining(t *testing.T) {
+	for _, tile := range []TileCoord{{1, 0, 0}, {1, 1, 1}, {12, 652, 1465}} {
+		west, south, east, north := tileBounds(tile)
+		lat, lng := (south+north)/2, (west+east)/2
+		if got := tileContaining(lat, lng, tile.Z); got != tile {
+			t.Errorf("centre of %+v is in %+v", tile, got)
+		}
+	}
+
+	// Zoom 1 tiles split the world at the equator and prime meridian
+	if west, south, east, north := tileBounds(TileCoord{1, 1, 0}); west != 0 || east != 180 || south != 0 || north != 90 {
+		t.Errorf("tile 1/1/0 = %v,%v,%v,%v", west, south, east, north)
+	}
+}
+
+func TestTilesNear(t *testing.T) {
+	// Just inside the east edge of 1/0/0, within the buffer of 1/1/0
+	near := tilesNear(10, -0.5, 1)
+	for _, want := range []TileCoord{{1, 0, 0}, {1, 1, 0}} {
+		if !slices.Contains(near, want) {
+			t.Errorf("tilesNear() = %v, missing %+v", near, want)
+		}
+	}
+
+	// Well inside a tile, only that tile draws the point
+	if near := tilesNear(45.5152, -122.6784, 12); len(near) != 1 {
+		t.Errorf("tilesNear() = %v, want only the containing tile", near)
+	}
+}
+
+func TestInvalidateTiles(t *testing.T) {
+	t.Parallel()
+	cache := newTileCache()
+
+	spot := models.Spot{Latitude: 45.5152, Longitude: -122.6784}
+	covering := tileContaining(spot.Latitude, spot.Longitude, 12)
+	elsewhere := tileContaining(-33.8688, 151.2093, 12)
+
+	cache.put(covering, []byte("portland"), cache.currentGeneration())
+	cache.put(elsewhere, []byte("sydney"), cache.currentGeneration())
+
+	cache.invalidate(spot)
+
+	if _, ok := cache.get(covering); ok {
+		t.Error("tile showing the spot should be dropped")
+	}
+	if _, ok := cache.get(elsewhere); !ok {
+		t.Error("tiles elsewhere should stay cached")
+	}
+}
+
+func TestTileCache_SkipsRendersThatRacedInvalidation(t *testing.T) {
+	t.Parallel()
+	cache := newTileCache()
+	tile := TileCoord{Z: 20, X: 1, Y: 2}
+
+	// A render starts, a spot changes, then the render finishes
+	generation := cache.currentGeneration()
+	cache.invalidatePoint(-33.8688, 151.2093)
+	cached := cache.put(tile, []byte("stale"), generation)
+
+	if string(cached.data) != "stale" {
+		t.Error("the render should still be served to its request")
+	}
+	if _, ok := cache.get(tile); ok {
+		t.Error("a render that raced an invalidation should not be cached")
+	}
+
+	cache.put(tile, []byte("fresh"), cache.currentGeneration())
+	if _, ok := cache.get(tile); !ok {
+		t.Error("a render after the invalidation should be cached")
+	}
+}
+
+func serveTile(t *testing.T, cache *tileCache, z, x, y, ifNoneMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("z", z)
+	rctx.URLParams.Add("x", x)
+	rctx.URLParams.Add("y", y)
+
+	r := httptest.NewRequest(http.MethodGet, "/tiles/spots/"+z+"/"+x+"/"+y+".mvt", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	if ifNoneMatch != "" {
+		r.Header.Set("If-None-Match", ifNoneMatch)
+	}
+
+	w := httptest.NewRecorder()
+	cache.serve(w, r)
+	return w
+}
+
+func TestTile_Caching(t *testing.T) {
+	t.Parallel()
+	cache := newTileCache()
+	tile := TileCoord{Z: 20, X: 1, Y: 2}
+	cached := cache.put(tile, []byte{0x1a, 0x02}, cache.currentGeneration())
+
+	w := serveTile(t, cache, "20", "1", "2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != tileContentType {
+		t.Errorf("Content-Type = %q, want %q", got, tileContentType)
+	}
+	if got := w.Header().Get("ETag"); got != cached.etag {
+		t.Errorf("ETag = %q, want %q", got, cached.etag)
+	}
+	if w.Header().Get("Cache-Control") != tileCacheControl {
+		t.Errorf("Cache-Control = %q", w.Header().Get("Cache-Control"))
+	}
+
+	if w := serveTile(t, cache, "20", "1", "2", cached.etag); w.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w := serveTile(t, cache, "20", "1", "2", `"stale"`); w.Code != http.StatusOK {
+		t.Errorf("stale ETag status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestTile_EmptyAndInvalid(t *testing.T) {
+	t.Parallel()
+	cache := newTileCache()
+	cache.put(TileCoord{Z: 20, X: 3, Y: 4}, nil, cache.currentGeneration())
+
+	if w := serveTile(t, cache, "20", "3", "4", ""); w.Code != http.StatusNoContent {
+		t.Errorf("empty tile status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := serveTile(t, cache, "2", "9", "0", ""); w.Code != http.StatusNotFound {
+		t.Errorf("invalid tile status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,169 @@
+package spot
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+)
+
+const (
+	maxTitleLength              = 100
+	maxDescriptionLength        = 2000
+	maxAddressLength            = 200
+	maxCityLength               = 100
+	maxStateLength              = 100
+	maxPostalCodeLength         = 20
+	maxAccessInstructionsLength = 1000
+)
+
+var (
+	spotTypes    = []models.SpotType{models.SpotTypeDriveway, models.SpotTypeGarage, models.SpotTypeLot, models.SpotTypeStreet}
+	vehicleSizes = []models.VehicleSize{models.VehicleSizeCompact, models.VehicleSizeStandard, models.VehicleSizeLarge, models.VehicleSizeOversized}
+)
+
+// Each check returns why a value is unacceptable, or "" if it's fine
+
+func checkRequired(value string, max int) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "Required"
+	}
+	return checkLength(value, max)
+}
+
+func checkLength(value string, max int) string {
+	if utf8.RuneCountInString(strings.TrimSpace(value)) > max {
+		return "Must be at most " + strconv.Itoa(max) + " characters"
+	}
+	return ""
+}
+
+// checkCountry wants an ISO 3166-1 alpha-2 code, in either case
+func checkCountry(code string) string {
+	if !countryCodes[strings.ToUpper(strings.TrimSpace(code))] {
+		return "Must be an ISO 3166-1 alpha-2 country code"
+	}
+	return ""
+}
+
+func checkLatitude(lat float64) string {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return "Must be between -90 and 90"
+	}
+	return ""
+}
+
+func checkLongitude(lng float64) string {
+	if math.IsNaN(lng) || lng < -180 || lng > 180 {
+		return "Must be between -180 and 180"
+	}
+	return ""
+}
+
+func checkSpotType(t models.SpotType) string {
+	if !slices.Contains(spotTypes, t) {
+		return "Must be one of driveway, garage, lot, street"
+	}
+	return ""
+}
+
+func checkVehicleSize(size models.VehicleSize) string {
+	if !slices.Contains(vehicleSizes, size) {
+		return "Must be one of compact, standard, large, oversized"
+	}
+	return ""
+}
+
+// validateCreateSpot checks a new listing. Spot type, vehicle size and
+// country may be left out for their defaults.
+func validateCreateSpot(req CreateSpotRequest) map[string]string {
+	errors := make(map[string]string)
+
+	set := func(field, msg string) {
+		if msg != "" {
+			errors[field] = msg
+		}
+	}
+
+	set("title", checkRequired(req.Title, maxTitleLength))
+	set("description", checkLength(req.Description, maxDescriptionLength))
+	set("address", checkRequired(req.Address, maxAddressLength))
+	set("city", checkRequired(req.City, maxCityLength))
+	set("state", checkLength(req.State, maxStateLength))
+	set("postal_code", checkLength(req.PostalCode, maxPostalCodeLength))
+
+	if req.Country != "" {
+		set("country", checkCountry(req.Country))
+	}
+	if req.SpotType != "" {
+		set("spot_type", checkSpotType(req.SpotType))
+	}
+	if req.VehicleSize != "" {
+		set("vehicle_size", checkVehicleSize(req.VehicleSize))
+	}
+
+	set("latitude", checkLatitude(req.Latitude))
+	set("longitude", checkLongitude(req.Longitude))
+	// Left-out coordinates decode as 0,0, which is open ocean
+	if req.Latitude == 0 && req.Longitude == 0 {
+		errors["latitude"] = "Required"
+		errors["longitude"] = "Required"
+	}
+
+	if !hasRate(req.HourlyRate, req.DailyRate, req.MonthlyRate) {
+		errors["rates"] = missingRateMessage
+	}
+	for field, rate := range map[string]*int{
+		"hourly_rate":  req.HourlyRate,
+		"daily_rate":   req.DailyRate,
+		"monthly_rate": req.MonthlyRate,
+	} {
+		if rate != nil {
+			set(field, checkRate(*rate))
+		}
+	}
+
+	return errors
+}
+
+// normalize trims a validated request and fills in defaults
+func (req *CreateSpotRequest) normalize() {
+	for _, field := range []*string{&req.Title, &req.Description, &req.Address, &req.City, &req.State, &req.PostalCode} {
+		*field = strings.TrimSpace(*field)
+	}
+
+	req.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	if req.Country == "" {
+		req.Country = "US"
+	}
+	if req.SpotType == "" {
+		req.SpotType = models.SpotTypeDriveway
+	}
+	if req.VehicleSize == "" {
+		req.VehicleSize = models.VehicleSizeStandard
+	}
+}
+
+const missingRateMessage = "Set at least one of hourly_rate, daily_rate, monthly_rate"
+
+// hasRate reports whether a spot can be priced at all
+func hasRate(rates ...*int) bool {
+	for _, rate := range rates {
+		if rate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRate checks a price in cents
+func checkRate(cents int) string {
+	if cents < 0 {
+		return "Must not be negative"
+	}
+	return ""
+}
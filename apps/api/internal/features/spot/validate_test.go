@@ -0,0 +1,108 @@
+package spot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+)
+
+func intPtr(v int) *int { return &v }
+
+func validCreateRequest() CreateSpotRequest {
+	return CreateSpotRequest{
+		Title:       "Covered driveway near the stadium",
+		Address:     "123 Main St",
+		City:        "Portland",
+		State:       "OR",
+		PostalCode:  "97201",
+		Country:     "US",
+		Latitude:    45.5152,
+		Longitude:   -122.6784,
+		SpotType:    models.SpotTypeDriveway,
+		VehicleSize: models.VehicleSizeStandard,
+		HourlyRate:  intPtr(400),
+	}
+}
+
+func TestValidateCreateSpot(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(req *CreateSpotRequest)
+		wantFields []string
+	}{
+		{name: "valid", modify: func(req *CreateSpotRequest) {}},
+		{
+			name: "defaults left out",
+			modify: func(req *CreateSpotRequest) {
+				req.Country, req.SpotType, req.VehicleSize = "", "", ""
+			},
+		},
+		{name: "lowercase country", modify: func(req *CreateSpotRequest) { req.Country = "ca" }},
+		{name: "free spot", modify: func(req *CreateSpotRequest) { req.HourlyRate = intPtr(0) }},
+		{name: "empty title", modify: func(req *CreateSpotRequest) { req.Title = "  " }, wantFields: []string{"title"}},
+		{name: "long title", modify: func(req *CreateSpotRequest) { req.Title = strings.Repeat("a", maxTitleLength+1) }, wantFields: []string{"title"}},
+		{name: "missing address", modify: func(req *CreateSpotRequest) { req.Address = "" }, wantFields: []string{"address"}},
+		{name: "missing city", modify: func(req *CreateSpotRequest) { req.City = "" }, wantFields: []string{"city"}},
+		{name: "long postal code", modify: func(req *CreateSpotRequest) { req.PostalCode = strings.Repeat("9", 21) }, wantFields: []string{"postal_code"}},
+		{name: "latitude 500", modify: func(req *CreateSpotRequest) { req.Latitude = 500 }, wantFields: []string{"latitude"}},
+		{name: "longitude -200", modify: func(req *CreateSpotRequest) { req.Longitude = -200 }, wantFields: []string{"longitude"}},
+		{
+			name:       "coordinates left out",
+			modify:     func(req *CreateSpotRequest) { req.Latitude, req.Longitude = 0, 0 },
+			wantFields: []string{"latitude", "longitude"},
+		},
+		{name: "unknown spot type", modify: func(req *CreateSpotRequest) { req.SpotType = "helipad" }, wantFields: []string{"spot_type"}},
+		{name: "unknown vehicle size", modify: func(req *CreateSpotRequest) { req.VehicleSize = "tank" }, wantFields: []string{"vehicle_size"}},
+		{name: "no rates", modify: func(req *CreateSpotRequest) { req.HourlyRate = nil }, wantFields: []string{"rates"}},
+		{name: "negative rate", modify: func(req *CreateSpotRequest) { req.DailyRate = intPtr(-100) }, wantFields: []string{"daily_rate"}},
+		{name: "three-letter country", modify: func(req *CreateSpotRequest) { req.Country = "USA" }, wantFields: []string{"country"}},
+		{name: "unassigned country", modify: func(req *CreateSpotRequest) { req.Country = "XX" }, wantFields: []string{"country"}},
+		{
+			name: "several problems",
+			modify: func(req *CreateSpotRequest) {
+				req.Title = ""
+				req.Latitude = -95
+				req.MonthlyRate = intPtr(-1)
+			},
+			wantFields: []string{"title", "latitude", "monthly_rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validCreateRequest()
+			tt.modify(&req)
+
+			errs := validateCreateSpot(req)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("errors = %v, want fields %v", errs, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("missing error for %s in %v", field, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateSpotRequest_Normalize(t *testing.T) {
+	req := validCreateRequest()
+	req.Title = "  Driveway  "
+	req.Country, req.SpotType, req.VehicleSize = "", "", ""
+	req.normalize()
+
+	if req.Title != "Driveway" {
+		t.Errorf("Title = %q, want it trimmed", req.Title)
+	}
+	if req.Country != "US" || req.SpotType != models.SpotTypeDriveway || req.VehicleSize != models.VehicleSizeStandard {
+		t.Errorf("defaults = %q %q %q, want US driveway standard", req.Country, req.SpotType, req.VehicleSize)
+	}
+
+	req.Country = "gb"
+	req.normalize()
+	if req.Country != "GB" {
+		t.Errorf("Country = %q, want GB", req.Country)
+	}
+}
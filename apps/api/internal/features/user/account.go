@@ -0,0 +1,252 @@
+package user
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/features/auth"
+	"github.com/brandon-kong/parkshare/apps/api/internal/features/spot"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// purgeGracePeriod is how long a deleted account's anonymized row and
+// soft-deleted spots are kept before being removed for good
+const purgeGracePeriod = 30 * 24 * time.Hour
+
+// Export is everything we hold about a user, for data access requests
+type Export struct {
+	ExportedAt time.Time             `json:"exported_at"`
+	Profile    *models.User          `json:"profile"`
+	Identities []models.UserIdentity `json:"identities"`
+	Sessions   []models.Session      `json:"sessions"`
+	APIKeys    []models.APIKey       `json:"api_keys"`
+	Spots      []models.Spot         `json:"spots"`
+}
+
+// BuildExport gathers a user's data, including spots and their photos
+func BuildExport(userID uuid.UUID) (*Export, error) {
+	user, err := GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &Export{ExportedAt: timeNow().UTC(), Profile: user}
+
+	if export.Identities, err = auth.ListIdentities(userID); err != nil {
+		return nil, err
+	}
+	if export.Sessions, err = auth.ListSessions(userID); err != nil {
+		return nil, err
+	}
+	if export.APIKeys, err = auth.ListAPIKeys(userID); err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Preload("Photos").
+		Where("host_id = ?", userID).
+		Order("created_at").
+		Find(&export.Spots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// WriteZip writes the export as a ZIP archive with one JSON file per section
+func (e *Export) WriteZip(w io.Writer) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"identities.json", e.Identities},
+		{"sessions.json", e.Sessions},
+		{"api_keys.json", e.APIKeys},
+		{"spots.json", e.Spots},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// DeleteAccount erases a user's personal data straight away: the row is
+// anonymized, logins and credentials are removed, spots are taken down and
+// every session is signed out. The anonymized remains are purged by
+// PurgeDeletedAccounts once the grace period is over.
+func DeleteAccount(ctx context.Context, userID uuid.UUID) error {
+	user, err := GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+	var listed []models.Spot
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			// Frees the real address so it can sign up again
+			"email":             fmt.Sprintf("deleted-%s@users.parkshare.invalid", userID),
+			"name":              "Deleted user",
+			"password_hash":     nil,
+			"avatar_url":        nil,
+			"phone":             nil,
+			"phone_verified_at": nil,
+			"bio":               nil,
+			"pending_email":     nil,
+			"is_verified":       false,
+			"purge_after":       now.Add(purgeGracePeriod),
+		}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&models.UserIdentity{},
+			&models.VerificationToken{},
+			&models.TOTPFactor{},
+			&models.RecoveryCode{},
+			&models.APIKey{},
+			&models.PhoneVerification{},
+			&models.UserRole{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Remembered so the map stops showing them
+		if err := tx.Select("latitude", "longitude").
+			Where("host_id = ? AND status = ?", userID, models.SpotStatusActive).
+			Find(&listed).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Spot{}).
+			Where("host_id = ?", userID).
+			Update("status", models.SpotStatusDeleted).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	spot.InvalidateTiles(listed...)
+
+	if err := auth.SignOutEverywhere(userID); err != nil {
+		return err
+	}
+
+	if user.AvatarURL != nil {
+		deleteStoredFile(ctx, *user.AvatarURL)
+	}
+
+	return nil
+}
+
+// PurgeDeletedAccounts removes accounts whose grace period ended before now,
+// along with their spots, photos and session history. It returns how many
+// accounts were purged.
+func PurgeDeletedAccounts(ctx context.Context, now time.Time) (int, error) {
+	var ids []uuid.UUID
+	err := database.DB.Model(&models.User{}).
+		Where("purge_after IS NOT NULL AND purge_after <= ?", now).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := purgeAccount(ctx, id); err != nil {
+			return i, err
+		}
+	}
+
+	return len(ids), nil
+}
+
+func purgeAccount(ctx context.Context, userID uuid.UUID) error {
+	var photos []models.SpotPhoto
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		spots := tx.Model(&models.Spot{}).Select("id").Where("host_id = ?", userID)
+
+		if err := tx.Where("spot_id IN (?)", spots).Find(&photos).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("spot_id IN (?)", spots).Delete(&models.SpotPhoto{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("host_id = ?", userID).Delete(&models.Spot{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", userID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, photo := range photos {
+		deleteStoredFile(ctx, photo.URL)
+	}
+
+	return nil
+}
+
+// RunPurger purges deleted accounts every interval until ctx is done
+func RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := PurgeDeletedAccounts(ctx, timeNow())
+		if err != nil {
+			log.Printf("Purging deleted accounts failed: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Purged %d deleted accounts\n", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteStoredFile removes an uploaded file we host. Failures are only
+// logged; a stray file isn't worth failing a deletion over.
+func deleteStoredFile(ctx context.Context, url string) {
+	key, ok := storage.KeyFromURL(url)
+	if !ok {
+		return
+	}
+	if err := storage.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete %s: %v\n", key, err)
+	}
+}
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestExport_WriteZip(t *testing.T) {
+	userID := uuid.New()
+	export := &Export{
+		ExportedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Profile:    &models.User{ID: userID, Email: "host@example.com", Name: "Sam Host"},
+		Spots: []models.Spot{{
+			ID:     uuid.New(),
+			HostID: userID,
+			Title:  "Driveway",
+			Photos: []models.SpotPhoto{{ID: uuid.New(), URL: "https://cdn.example.com/p.jpg"}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteZip(&buf); err != nil {
+		t.Fatalf("WriteZip failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Archive should be a valid zip: %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	for _, name := range []string{"profile.json", "identities.json", "sessions.json", "api_keys.json", "spots.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Archive is missing %s", name)
+		}
+	}
+
+	var profile models.User
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.Email != "host@example.com" {
+		t.Errorf("profile.json = %s, %v", files["profile.json"], err)
+	}
+
+	var spots []models.Spot
+	if err := json.Unmarshal(files["spots.json"], &spots); err != nil || len(spots) != 1 || len(spots[0].Photos) != 1 {
+		t.Errorf("spots.json should include the spot and its photos, got %s", files["spots.json"])
+	}
+}
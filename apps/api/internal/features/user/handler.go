@@ -0,0 +1,240 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/features/auth"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Routes are the signed-in user's own profile, mounted at /me
+func Routes() chi.Router {
+	router := chi.NewRouter()
+
+	router.Get("/", Me)
+	router.Patch("/", UpdateMe)
+	router.With(auth.RequireRecentAuth(auth.ReauthMaxAge)).Delete("/", DeleteMe)
+	router.Post("/export", ExportMe)
+	router.Put("/avatar", UploadAvatar)
+	router.Post("/phone/verify", SendPhoneCodeHandler)
+	router.Post("/phone/confirm", ConfirmPhoneHandler)
+
+	return router
+}
+
+// PublicRoutes are profiles as other users see them, mounted at /users
+func PublicRoutes() chi.Router {
+	router := chi.NewRouter()
+
+	router.Get("/{id}", Profile)
+
+	return router
+}
+
+func Me(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	user, err := GetUser(claims.UserID)
+	if err != nil {
+		util.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, user)
+}
+
+func UpdateMe(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if errs := validateProfileUpdate(req); len(errs) > 0 {
+		util.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":  "Validation failed",
+			"fields": errs,
+		})
+		return
+	}
+
+	user, err := UpdateProfile(claims.UserID, req)
+	if err != nil {
+		util.WriteError(w, http.StatusInternalServerError, "Failed to update profile")
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, user)
+}
+
+// UploadAvatar takes a multipart form with the image in an "avatar" field
+func UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+1<<20)
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, "Missing avatar file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+	if err != nil {
+		util.WriteError(w, http.StatusBadRequest, "Failed to read avatar")
+		return
+	}
+	if len(data) > maxAvatarSize {
+		util.WriteError(w, http.StatusRequestEntityTooLarge, "Avatar must be at most 5 MB")
+		return
+	}
+
+	user, err := SetAvatar(r.Context(), claims.UserID, data)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedAvatarType) {
+			util.WriteError(w, http.StatusUnsupportedMediaType, "Avatar must be a JPEG, PNG or WebP image")
+			return
+		}
+		util.WriteError(w, http.StatusInternalServerError, "Failed to save avatar")
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, user)
+}
+
+// ExportMe downloads the user's data as a ZIP archive, or as a single JSON
+// document with ?format=json
+func ExportMe(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	export, err := BuildExport(claims.UserID)
+	if err != nil {
+		util.WriteError(w, http.StatusInternalServerError, "Failed to export data")
+		return
+	}
+
+	filename := "parkshare-export-" + export.ExportedAt.Format("2006-01-02")
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		util.WriteJSON(w, http.StatusOK, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	w.WriteHeader(http.StatusOK)
+	if err := export.WriteZip(w); err != nil {
+		log.Printf("Failed to write export for %s: %v\n", claims.UserID, err)
+	}
+}
+
+// DeleteMe deletes the signed-in user's account
+func DeleteMe(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	if err := DeleteAccount(r.Context(), claims.UserID); err != nil {
+		util.WriteError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]string{"message": "Account deleted"})
+}
+
+func Profile(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		util.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	user, err := GetUser(id)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			util.WriteError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		util.WriteError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+
+	// Deleted accounts linger anonymized until purged, but aren't shown
+	if user.PurgeAfter != nil {
+		util.WriteError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, toPublicProfile(user))
+}
+
+func SendPhoneCodeHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	err := SendPhoneCode(r.Context(), claims.UserID)
+	if err != nil {
+		var limit *PhoneCodeLimitError
+		switch {
+		case errors.As(err, &limit):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfter.Seconds()))))
+			util.WriteError(w, http.StatusTooManyRequests, "Please wait before requesting another code")
+		case errors.Is(err, ErrNoPhone):
+			util.WriteError(w, http.StatusBadRequest, "Add a phone number to your profile first")
+		case errors.Is(err, ErrPhoneAlreadyVerified):
+			util.WriteError(w, http.StatusConflict, "Phone number already verified")
+		default:
+			util.WriteError(w, http.StatusInternalServerError, "Failed to send code")
+		}
+		return
+	}
+
+	util.WriteJSON(w, http.StatusAccepted, map[string]string{"message": "Verification code sent"})
+}
+
+func ConfirmPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	claims := auth.GetUserFromContext(r.Context())
+
+	var req ConfirmPhoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		util.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := ConfirmPhone(claims.UserID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPhoneCode):
+			util.WriteError(w, http.StatusBadRequest, "Invalid or expired code")
+		case errors.Is(err, ErrTooManyPhoneAttempts):
+			util.WriteError(w, http.StatusTooManyRequests, "Too many wrong codes, request a new one")
+		default:
+			util.WriteError(w, http.StatusInternalServerError, "Failed to verify phone")
+		}
+		return
+	}
+
+	util.WriteJSON(w, http.StatusOK, user)
+}
+
+// UpdateProfileRequest holds the fields to change; omitted fields are left
+// as they are. Phone and bio can be cleared with null.
+type UpdateProfileRequest struct {
+	Name  util.Optional[string] `json:"name"`
+	Phone util.Optional[string] `json:"phone"`
+	Bio   util.Optional[string] `json:"bio"`
+}
+
+type ConfirmPhoneRequest struct {
+	Code string `json:"code"`
+}
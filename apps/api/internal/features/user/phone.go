@@ -0,0 +1,206 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/internal/sms"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoPhone              = errors.New("no phone number on profile")
+	ErrPhoneAlreadyVerified = errors.New("phone number already verified")
+	ErrInvalidPhoneCode     = errors.New("invalid or expired code")
+	ErrTooManyPhoneAttempts = errors.New("too many wrong codes")
+	ErrTooManyPhoneCodes    = errors.New("too many codes requested")
+)
+
+// PhoneCodeLimitError is returned when another code can't be sent yet. It
+// matches ErrTooManyPhoneCodes with errors.Is.
+type PhoneCodeLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *PhoneCodeLimitError) Error() string {
+	return ErrTooManyPhoneCodes.Error()
+}
+
+func (e *PhoneCodeLimitError) Is(target error) bool {
+	return target == ErrTooManyPhoneCodes
+}
+
+const (
+	phoneCodeDigits = 6
+	phoneCodeTTL    = 10 * time.Minute
+	// maxPhoneCodeAttempts is how many wrong guesses a code survives
+	maxPhoneCodeAttempts = 5
+	// phoneResendCooldown is the minimum gap between two codes
+	phoneResendCooldown = time.Minute
+	// maxPhoneCodesPerWindow caps texts per phoneCodeWindow, since every
+	// one costs money and SMS pumping is a common abuse
+	maxPhoneCodesPerWindow = 5
+	phoneCodeWindow        = time.Hour
+)
+
+// timeNow is swapped for a fixed clock in tests
+var timeNow = time.Now
+
+// phoneCodeWait says how long until another code may be sent, zero if now
+func phoneCodeWait(v *models.PhoneVerification, now time.Time) time.Duration {
+	if v == nil {
+		return 0
+	}
+
+	var wait time.Duration
+	if next := v.LastSentAt.Add(phoneResendCooldown); next.After(now) {
+		wait = next.Sub(now)
+	}
+
+	windowEnd := v.WindowStart.Add(phoneCodeWindow)
+	if v.Sends >= maxPhoneCodesPerWindow && windowEnd.After(now) {
+		wait = max(wait, windowEnd.Sub(now))
+	}
+
+	return wait
+}
+
+// newPhoneCode returns a random numeric code
+func newPhoneCode() (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < phoneCodeDigits; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", phoneCodeDigits, n), nil
+}
+
+// hashPhoneCode ties a code to its user so equal codes hash differently
+func hashPhoneCode(userID uuid.UUID, code string) string {
+	sum := sha256.Sum256([]byte(userID.String() + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// SendPhoneCode texts a verification code to the phone on the user's profile
+func SendPhoneCode(ctx context.Context, userID uuid.UUID) error {
+	user, err := GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.Phone == nil {
+		return ErrNoPhone
+	}
+	if user.PhoneVerifiedAt != nil {
+		return ErrPhoneAlreadyVerified
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		return err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var v models.PhoneVerification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&v, "user_id = ?", userID).Error
+		found := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		now := timeNow()
+		if found {
+			if wait := phoneCodeWait(&v, now); wait > 0 {
+				return &PhoneCodeLimitError{RetryAfter: wait}
+			}
+		}
+
+		if !found || now.Sub(v.WindowStart) > phoneCodeWindow {
+			v.Sends = 0
+			v.WindowStart = now
+		}
+
+		v.UserID = userID
+		v.Phone = *user.Phone
+		v.CodeHash = hashPhoneCode(userID, code)
+		v.ExpiresAt = now.Add(phoneCodeTTL)
+		v.Attempts = 0
+		v.Sends++
+		v.LastSentAt = now
+
+		return tx.Save(&v).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return sms.Send(ctx, sms.Message{
+		To:   *user.Phone,
+		Body: fmt.Sprintf("Your ParkShare verification code is %s. It expires in 10 minutes.", code),
+	})
+}
+
+// ConfirmPhone checks a code and marks the phone verified. Each code allows
+// a handful of guesses before a new one has to be requested.
+func ConfirmPhone(userID uuid.UUID, code string) (*models.User, error) {
+	var wrong bool
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var v models.PhoneVerification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&v, "user_id = ?", userID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidPhoneCode
+		}
+		if err != nil {
+			return err
+		}
+
+		if v.Attempts >= maxPhoneCodeAttempts {
+			return ErrTooManyPhoneAttempts
+		}
+
+		var user models.User
+		if err := tx.First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		// A code is only good for the number it was sent to
+		now := timeNow()
+		if now.After(v.ExpiresAt) || user.Phone == nil || *user.Phone != v.Phone {
+			return ErrInvalidPhoneCode
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hashPhoneCode(userID, code)), []byte(v.CodeHash)) != 1 {
+			// Committed, not rolled back, so the guess counts
+			wrong = true
+			return tx.Model(&v).Update("attempts", v.Attempts+1).Error
+		}
+
+		if err := tx.Model(&user).Update("phone_verified_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&v).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if wrong {
+		return nil, ErrInvalidPhoneCode
+	}
+
+	return GetUser(userID)
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestPhoneCodeWait(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		v    *models.PhoneVerification
+		want time.Duration
+	}{
+		{name: "first code", v: nil, want: 0},
+		{
+			name: "within cooldown",
+			v:    &models.PhoneVerification{Sends: 1, WindowStart: now.Add(-20 * time.Second), LastSentAt: now.Add(-20 * time.Second)},
+			want: 40 * time.Second,
+		},
+		{
+			name: "after cooldown",
+			v:    &models.PhoneVerification{Sends: 2, WindowStart: now.Add(-10 * time.Minute), LastSentAt: now.Add(-2 * time.Minute)},
+			want: 0,
+		},
+		{
+			name: "window used up",
+			v:    &models.PhoneVerification{Sends: maxPhoneCodesPerWindow, WindowStart: now.Add(-40 * time.Minute), LastSentAt: now.Add(-5 * time.Minute)},
+			want: 20 * time.Minute,
+		},
+		{
+			name: "window expired",
+			v:    &models.PhoneVerification{Sends: maxPhoneCodesPerWindow, WindowStart: now.Add(-2 * time.Hour), LastSentAt: now.Add(-70 * time.Minute)},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := phoneCodeWait(tt.v, now); got != tt.want {
+				t.Errorf("phoneCodeWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPhoneCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := newPhoneCode()
+		if err != nil {
+			t.Fatalf("newPhoneCode failed: %v", err)
+		}
+		if len(code) != phoneCodeDigits {
+			t.Fatalf("code %q should have %d digits", code, phoneCodeDigits)
+		}
+		for _, c := range code {
+			if c < '0' || c > '9' {
+				t.Fatalf("code %q should be numeric", code)
+			}
+		}
+	}
+}
+
+func TestHashPhoneCode_PerUser(t *testing.T) {
+	if hashPhoneCode(uuid.New(), "123456") == hashPhoneCode(uuid.New(), "123456") {
+		t.Error("The same code for different users should hash differently")
+	}
+}
@@ -0,0 +1,193 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/database"
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUnsupportedAvatarType = errors.New("avatar must be a JPEG, PNG or WebP image")
+)
+
+const (
+	maxNameLength = 100
+	maxBioLength  = 500
+	maxAvatarSize = 5 << 20
+)
+
+// e164 matches a phone number in international format, e.g. +14155552671
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// avatarTypes maps the image types we accept to their file extensions
+var avatarTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// PublicProfile is what other users can see about someone
+type PublicProfile struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	AvatarURL *string   `json:"avatar_url"`
+	Bio       *string   `json:"bio"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toPublicProfile(user *models.User) PublicProfile {
+	return PublicProfile{
+		ID:        user.ID,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+		Bio:       user.Bio,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+func validateProfileUpdate(req UpdateProfileRequest) map[string]string {
+	errors := make(map[string]string)
+
+	if req.Name.Set {
+		name := strings.TrimSpace(req.Name.Value)
+		if req.Name.Null || name == "" {
+			errors["name"] = "Name is required"
+		} else if utf8.RuneCountInString(name) > maxNameLength {
+			errors["name"] = "Name must be at most 100 characters"
+		}
+	}
+
+	if req.Phone.Set && !req.Phone.Null && req.Phone.Value != "" && !e164.MatchString(req.Phone.Value) {
+		errors["phone"] = "Phone must be in international format, e.g. +14155552671"
+	}
+
+	if req.Bio.Set && !req.Bio.Null && utf8.RuneCountInString(req.Bio.Value) > maxBioLength {
+		errors["bio"] = "Bio must be at most 500 characters"
+	}
+
+	return errors
+}
+
+// GetUser loads a user by ID
+func GetUser(id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := database.DB.First(&user, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateProfile applies the fields present in req. A null or empty phone or
+// bio clears it.
+func UpdateProfile(userID uuid.UUID, req UpdateProfileRequest) (*models.User, error) {
+	user, err := GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name.Set {
+		updates["name"] = strings.TrimSpace(req.Name.Value)
+	}
+	if req.Phone.Set {
+		phone := nullable(req.Phone.Value)
+		updates["phone"] = phone
+
+		// A new number has to be verified again
+		if phone == nil || user.Phone == nil || *phone != *user.Phone {
+			updates["phone_verified_at"] = nil
+		}
+	}
+	if req.Bio.Set {
+		updates["bio"] = nullable(strings.TrimSpace(req.Bio.Value))
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return GetUser(userID)
+}
+
+// SetAvatar stores a new avatar image and points the user at it. The image
+// type is sniffed from the content rather than trusted from the client.
+func SetAvatar(ctx context.Context, userID uuid.UUID, data []byte) (*models.User, error) {
+	user, err := GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := replaceAvatar(ctx, user, data); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// saveAvatarURL points the user's row at a new avatar. GORM writes url back
+// into user.AvatarURL.
+var saveAvatarURL = func(user *models.User, url string) error {
+	return database.DB.Model(user).Update("avatar_url", url).Error
+}
+
+// replaceAvatar uploads data as the user's avatar and removes the one it
+// replaces
+func replaceAvatar(ctx context.Context, user *models.User, data []byte) error {
+	contentType := http.DetectContentType(data)
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		return ErrUnsupportedAvatarType
+	}
+
+	// A fresh name each time so caches never serve the old picture
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return err
+	}
+	key := "avatars/" + user.ID.String() + "/" + hex.EncodeToString(name) + ext
+
+	url, err := storage.Put(ctx, key, contentType, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// Saving overwrites user.AvatarURL, so hold on to the old one first
+	old := user.AvatarURL
+	if err := saveAvatarURL(user, url); err != nil {
+		return err
+	}
+
+	// Avatars from OAuth providers aren't ours, and are left alone
+	if old != nil {
+		deleteStoredFile(ctx, *old)
+	}
+
+	user.AvatarURL = &url
+	return nil
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brandon-kong/parkshare/apps/api/internal/models"
+	"github.com/brandon-kong/parkshare/apps/api/internal/storage"
+	"github.com/brandon-kong/parkshare/apps/api/util"
+	"github.com/google/uuid"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func set(s string) util.Optional[string] {
+	return util.Optional[string]{Set: true, Value: s}
+}
+
+func null() util.Optional[string] {
+	return util.Optional[string]{Set: true, Null: true}
+}
+
+func TestUpdateProfileRequest_NullVersusAbsent(t *testing.T) {
+	var req UpdateProfileRequest
+	if err := json.Unmarshal([]byte(`{"bio": null}`), &req); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if !req.Bio.Set || !req.Bio.Null {
+		t.Error("A null bio should be sent as a clear")
+	}
+	if req.Phone.Set || req.Name.Set {
+		t.Error("Fields left out should not be set")
+	}
+}
+
+func TestValidateProfileUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       UpdateProfileRequest
+		wantField string
+	}{
+		{name: "empty update", req: UpdateProfileRequest{}},
+		{name: "valid", req: UpdateProfileRequest{Name: set("Sam Host"), Phone: set("+14155552671"), Bio: set("Driveway near the stadium")}},
+		{name: "clear phone", req: UpdateProfileRequest{Phone: set("")}},
+		{name: "null phone", req: UpdateProfileRequest{Phone: null()}},
+		{name: "null bio", req: UpdateProfileRequest{Bio: null()}},
+		{name: "null name", req: UpdateProfileRequest{Name: null()}, wantField: "name"},
+		{name: "blank name", req: UpdateProfileRequest{Name: set("   ")}, wantField: "name"},
+		{name: "long name", req: UpdateProfileRequest{Name: set(strings.Repeat("a", maxNameLength+1))}, wantField: "name"},
+		{name: "national phone", req: UpdateProfileRequest{Phone: set("4155552671")}, wantField: "phone"},
+		{name: "phone with spaces", req: UpdateProfileRequest{Phone: set("+1 415 555 2671")}, wantField: "phone"},
+		{name: "phone too long", req: UpdateProfileRequest{Phone: set("+1234567890123456")}, wantField: "phone"},
+		{name: "long bio", req: UpdateProfileRequest{Bio: set(strings.Repeat("é", maxBioLength+1))}, wantField: "bio"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateProfileUpdate(tt.req)
+			if tt.wantField == "" && len(errs) > 0 {
+				t.Errorf("Expected no errors, got %v", errs)
+			}
+			if tt.wantField != "" {
+				if _, ok := errs[tt.wantField]; !ok {
+					t.Errorf("Expected error on %q, got %v", tt.wantField, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestPublicProfile_HidesPrivateFields(t *testing.T) {
+	user := &models.User{
+		ID:    uuid.New(),
+		Email: "host@example.com",
+		Name:  "Sam Host",
+		Phone: ptr("+14155552671"),
+		Bio:   ptr("Hi"),
+	}
+
+	body, err := json.Marshal(toPublicProfile(user))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	for _, private := range []string{"host@example.com", "+14155552671", "email", "phone"} {
+		if strings.Contains(string(body), private) {
+			t.Errorf("Public profile %s should not contain %q", body, private)
+		}
+	}
+}
+
+func TestReplaceAvatar_KeepsNewDeletesOld(t *testing.T) {
+	mem := storage.NewMemoryStorage("https://cdn.example.com/uploads")
+	storage.Default = mem
+
+	// Mimic GORM writing the new value back into the model
+	saveAvatarURL = func(user *models.User, url string) error {
+		user.AvatarURL = &url
+		return nil
+	}
+
+	ctx := context.Background()
+	user := &models.User{ID: uuid.New()}
+	png := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16))
+
+	if err := replaceAvatar(ctx, user, png); err != nil {
+		t.Fatalf("First upload failed: %v", err)
+	}
+	oldKey, ok := storage.KeyFromURL(*user.AvatarURL)
+	if !ok {
+		t.Fatalf("Avatar URL %q should be ours", *user.AvatarURL)
+	}
+
+	if err := replaceAvatar(ctx, user, png); err != nil {
+		t.Fatalf("Second upload failed: %v", err)
+	}
+	newKey, ok := storage.KeyFromURL(*user.AvatarURL)
+	if !ok {
+		t.Fatalf("Avatar URL %q should be ours", *user.AvatarURL)
+	}
+
+	if _, ok := mem.Get(newKey); !ok {
+		t.Error("The new avatar should still be stored after upload")
+	}
+	if _, ok := mem.Get(oldKey); ok {
+		t.Error("The replaced avatar should be deleted")
+	}
+}
+
+func TestReplaceAvatar_RejectsNonImages(t *testing.T) {
+	storage.Default = storage.NewMemoryStorage("https://cdn.example.com/uploads")
+
+	err := replaceAvatar(context.Background(), &models.User{ID: uuid.New()}, []byte("<html></html>"))
+	if err != ErrUnsupportedAvatarType {
+		t.Errorf("replaceAvatar() error = %v, want %v", err, ErrUnsupportedAvatarType)
+	}
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var Default Mailer = NewMemoryMailer()
+
+// Setup picks the mailer from MAIL_DRIVER: "smtp", "file" (writes .eml files
+// to MAIL_DIR for local dev) or "memory". Defaults to memory, which only logs.
+func Setup() error {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		m, err := NewSMTPMailerFromEnv()
+		if err != nil {
+			return err
+		}
+		Default = m
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+		m, err := NewFileMailer(dir)
+		if err != nil {
+			return err
+		}
+		Default = m
+	case "", "memory":
+		Default = NewMemoryMailer()
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+
+	log.Printf("Using %T for mail\n", Default)
+	return nil
+}
+
+// Send delivers a message with the default mailer
+func Send(ctx context.Context, msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+	return Default.Send(ctx, msg)
+}
+
+// validate rejects header injection through the fields that end up in headers
+func validate(msg Message) error {
+	if msg.To == "" {
+		return errors.New("mail: missing recipient")
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("mail: invalid header value")
+	}
+	return nil
+}
+
+// format renders a message as RFC 5322 text
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func fromAddress() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "ParkShare <no-reply@parkshare.local>"
+}
@@ -0,0 +1,94 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSend_RejectsHeaderInjection(t *testing.T) {
+	Default = NewMemoryMailer()
+
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			msg:  Message{To: "host@example.com", Subject: "Hello", Body: "Line one\nLine two"},
+		},
+		{
+			name:    "missing recipient",
+			msg:     Message{Subject: "Hello"},
+			wantErr: true,
+		},
+		{
+			name:    "newline in subject",
+			msg:     Message{To: "host@example.com", Subject: "Hello\r\nBcc: victim@example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "newline in recipient",
+			msg:     Message{To: "host@example.com\nBcc: victim@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Send(context.Background(), tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	Default = m
+
+	if _, ok := m.Last(); ok {
+		t.Error("Last() should report no messages on a new mailer")
+	}
+
+	Send(context.Background(), Message{To: "a@example.com", Subject: "First"})
+	Send(context.Background(), Message{To: "b@example.com", Subject: "Second"})
+
+	if got := len(m.Messages()); got != 2 {
+		t.Errorf("Expected 2 messages, got %d", got)
+	}
+
+	last, _ := m.Last()
+	if last.To != "b@example.com" {
+		t.Errorf("Last().To = %q, want b@example.com", last.To)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatalf("NewFileMailer failed: %v", err)
+	}
+
+	msg := Message{To: "renter@example.com", Subject: "Verify your email", Body: "Click here"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 .eml file, got %d", len(files))
+	}
+
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{"To: renter@example.com\r\n", "Subject: Verify your email\r\n", "\r\n\r\nClick here"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Message file missing %q", want)
+		}
+	}
+}
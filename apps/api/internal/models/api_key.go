@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey lets a partner call the API as a user without their password. Only
+// the prefix is stored in the clear; the full key is shown once at creation.
+type APIKey struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	Name       string    `gorm:"not null" json:"name"`
+	Prefix     string    `gorm:"uniqueIndex;not null" json:"prefix"`
+	SecretHash string    `gorm:"not null" json:"-"`
+	Scopes     []string  `gorm:"serializer:json;type:jsonb;not null" json:"scopes"`
+	// RateLimit is how many requests per minute the key may make
+	RateLimit  int        `gorm:"not null" json:"rate_limit"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
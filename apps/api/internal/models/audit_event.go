@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEvent is one entry in the security audit log. Rows are only ever
+// inserted; the database rejects updates and deletes.
+type AuditEvent struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Action string    `gorm:"type:varchar(64);not null;index" json:"action"`
+	// ActorID is who did it, if they were signed in
+	ActorID *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	// ImpersonatorID is the admin behind the actor, when impersonating
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid;index" json:"impersonator_id,omitempty"`
+	// APIKeyID is set when the actor used an API key
+	APIKeyID   *uuid.UUID             `gorm:"type:uuid" json:"api_key_id,omitempty"`
+	IP         string                 `json:"ip"`
+	UserAgent  string                 `json:"user_agent"`
+	TargetType string                 `gorm:"type:varchar(32);index:idx_audit_target" json:"target_type,omitempty"`
+	TargetID   string                 `gorm:"index:idx_audit_target" json:"target_id,omitempty"`
+	Metadata   map[string]interface{} `gorm:"serializer:json;type:jsonb" json:"metadata,omitempty"`
+	CreatedAt  time.Time              `gorm:"not null;index" json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent login attempts that haven't yet succeeded for
+// a key such as an email address or an email + IP pair. Keys don't have to
+// match an account.
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// OAuthNonce is a nonce handed out when a client starts an external login.
+// The provider's ID token must carry it, and it can be redeemed once. Only
+// its hash is stored.
+type OAuthNonce struct {
+	NonceHash string    `gorm:"primaryKey" json:"-"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
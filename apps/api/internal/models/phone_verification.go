@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PhoneVerification is the outstanding SMS code for a user's phone number.
+// Only the code's hash is stored.
+type PhoneVerification struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Phone     string    `gorm:"not null" json:"phone"`
+	CodeHash  string    `gorm:"not null" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	// Attempts counts wrong guesses at the current code
+	Attempts int `gorm:"not null;default:0" json:"-"`
+	// Sends counts codes sent since WindowStart, to cap SMS volume
+	Sends       int       `gorm:"not null;default:0" json:"-"`
+	WindowStart time.Time `json:"-"`
+	LastSentAt  time.Time `json:"last_sent_at"`
+}
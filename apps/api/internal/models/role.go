@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleHost   Role = "host"
+	RoleRenter Role = "renter"
+)
+
+// DefaultRoles are granted to every new account: anyone can book a spot
+// and list their own
+var DefaultRoles = []Role{RoleRenter, RoleHost}
+
+// UserRole grants a role to a user
+type UserRole struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Role      Role      `gorm:"type:varchar(20);primaryKey" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
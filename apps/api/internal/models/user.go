@@ -6,14 +6,21 @@ import (
 )
 
 type User struct {
-    ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-    Email        string    `gorm:"uniqueIndex;not null" json:"email"`
-    PasswordHash *string   `gorm:"not null" json:"-"`
-    Name         string    `gorm:"not null" json:"name"`
-    AvatarURL    *string   `json:"avatar_url"`
-    Phone        *string   `json:"phone"`
-    IsVerified   bool      `gorm:"default:false" json:"is_verified"`
-    Provider     string    `gorm:"default:'email'" json:"provider"`
-    CreatedAt    time.Time `json:"created_at"`
-    UpdatedAt    time.Time `json:"updated_at"`
+    ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+    Email           string     `gorm:"uniqueIndex;not null" json:"email"`
+    PasswordHash    *string    `json:"-"`
+    Name            string     `gorm:"not null" json:"name"`
+    AvatarURL       *string    `json:"avatar_url"`
+    Phone           *string    `json:"phone"`
+    PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+    Bio             *string    `json:"bio"`
+    IsVerified      bool       `gorm:"default:false" json:"is_verified"`
+    // PendingEmail is an address the user asked to switch to but hasn't confirmed
+    PendingEmail    *string    `json:"pending_email,omitempty"`
+    Provider        string     `gorm:"default:'email'" json:"provider"`
+    // PurgeAfter is set once the account is deleted; the anonymized row is
+    // removed for good after this time
+    PurgeAfter      *time.Time `gorm:"index" json:"-"`
+    CreatedAt       time.Time  `json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
 }
\ No newline at end of file
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenPurpose says which flow a VerificationToken belongs to, so a token
+// emailed for one flow can never be redeemed in another
+type TokenPurpose string
+
+const (
+	TokenPurposeEmailVerification TokenPurpose = "email_verification"
+	TokenPurposePasswordReset     TokenPurpose = "password_reset"
+	TokenPurposeMagicLink         TokenPurpose = "magic_link"
+	TokenPurposeEmailChange       TokenPurpose = "email_change"
+	// TokenPurposeMFAChallenge records the jti of an MFA challenge token so
+	// it can only be redeemed once
+	TokenPurposeMFAChallenge TokenPurpose = "mfa_challenge"
+)
+
+// VerificationToken is a single-use secret sent to the user out of band.
+// Only its hash is stored.
+type VerificationToken struct {
+	ID        uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"user_id"`
+	Purpose   TokenPurpose `gorm:"type:varchar(32);not null" json:"purpose"`
+	TokenHash string       `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time    `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time   `json:"used_at,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
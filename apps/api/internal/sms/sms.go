@@ -0,0 +1,50 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+type Message struct {
+	// To is the recipient in E.164 format
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages
+type SMSSender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var Default SMSSender = NewMemorySender()
+
+// Setup picks the sender from SMS_DRIVER: "twilio" or "memory". Defaults to
+// memory, which only logs.
+func Setup() error {
+	switch driver := os.Getenv("SMS_DRIVER"); driver {
+	case "twilio":
+		s, err := NewTwilioSenderFromEnv()
+		if err != nil {
+			return err
+		}
+		Default = s
+	case "", "memory":
+		Default = NewMemorySender()
+	default:
+		return fmt.Errorf("unknown SMS_DRIVER %q", driver)
+	}
+
+	log.Printf("Using %T for SMS\n", Default)
+	return nil
+}
+
+// Send delivers a message with the default sender
+func Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return errors.New("sms: missing recipient")
+	}
+	return Default.Send(ctx, msg)
+}
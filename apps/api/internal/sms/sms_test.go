@@ -0,0 +1,70 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSend_RequiresRecipient(t *testing.T) {
+	Default = NewMemorySender()
+
+	if err := Send(context.Background(), Message{Body: "hi"}); err == nil {
+		t.Error("Expected an error for a message without a recipient")
+	}
+}
+
+func TestMemorySender_Records(t *testing.T) {
+	s := NewMemorySender()
+	Default = s
+
+	Send(context.Background(), Message{To: "+14155552671", Body: "first"})
+	Send(context.Background(), Message{To: "+14155552671", Body: "second"})
+
+	if got := len(s.Messages()); got != 2 {
+		t.Errorf("Messages() has %d messages, want 2", got)
+	}
+	if last, ok := s.Last(); !ok || last.Body != "second" {
+		t.Errorf("Last() = %+v, %v", last, ok)
+	}
+}
+
+func TestTwilioSender(t *testing.T) {
+	var gotPath, gotUser, gotPass, gotTo, gotFrom, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotUser, gotPass, _ = r.BasicAuth()
+		r.ParseForm()
+		gotTo, gotFrom, gotBody = r.PostForm.Get("To"), r.PostForm.Get("From"), r.PostForm.Get("Body")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	s := &TwilioSender{AccountSID: "AC123", AuthToken: "secret", From: "+15005550006", BaseURL: server.URL, Client: server.Client()}
+	if err := s.Send(context.Background(), Message{To: "+14155552671", Body: "Your code is 123456"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	if gotPath != "/2010-04-01/Accounts/AC123/Messages.json" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotUser != "AC123" || gotPass != "secret" {
+		t.Errorf("basic auth = %q, %q", gotUser, gotPass)
+	}
+	if gotTo != "+14155552671" || gotFrom != "+15005550006" || gotBody != "Your code is 123456" {
+		t.Errorf("form = To %q From %q Body %q", gotTo, gotFrom, gotBody)
+	}
+}
+
+func TestTwilioSender_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"code": 21211, "message": "Invalid 'To' Phone Number"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s := &TwilioSender{AccountSID: "AC123", AuthToken: "secret", From: "+15005550006", BaseURL: server.URL, Client: server.Client()}
+	if err := s.Send(context.Background(), Message{To: "+1", Body: "x"}); err == nil {
+		t.Error("Expected an error for a non-2xx response")
+	}
+}
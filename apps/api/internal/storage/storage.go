@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Storage keeps uploaded files, such as avatars, and says where they can be
+// fetched from
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader) error
+	Delete(ctx context.Context, key string) error
+	// URL is the public address of the object at key
+	URL(key string) string
+}
+
+var Default Storage = NewMemoryStorage("http://localhost:5000/uploads")
+
+// Setup picks the storage from STORAGE_DRIVER: "local" (files under
+// STORAGE_DIR) or "memory". Both are served at /uploads. Defaults to memory,
+// which loses everything on restart. STORAGE_PUBLIC_URL is the base URL objects
+// are linked from.
+func Setup() error {
+	baseURL := os.Getenv("STORAGE_PUBLIC_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:5000/uploads"
+	}
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "tmp/uploads"
+		}
+		s, err := NewLocalStorage(dir, baseURL)
+		if err != nil {
+			return err
+		}
+		Default = s
+	case "", "memory":
+		Default = NewMemoryStorage(baseURL)
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+
+	log.Printf("Using %T for uploads\n", Default)
+	return nil
+}
+
+// Handler serves the default storage's objects, for drivers that host them
+// on this server. It reports false when objects are served from elsewhere.
+func Handler() (http.Handler, bool) {
+	h, ok := Default.(interface{ Handler() http.Handler })
+	if !ok {
+		return nil, false
+	}
+	return h.Handler(), true
+}
+
+// Put stores an object with the default storage and returns its URL
+func Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	if err := Default.Put(ctx, key, contentType, body); err != nil {
+		return "", err
+	}
+	return Default.URL(key), nil
+}
+
+// Delete removes an object from the default storage
+func Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return Default.Delete(ctx, key)
+}
+
+// KeyFromURL recovers the key of an object the default storage linked to.
+// It reports false for URLs that point somewhere else.
+func KeyFromURL(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, Default.URL(""))
+	if !ok || validateKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// validateKey only allows clean relative paths, so a key can't escape the
+// storage root
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return errors.New("storage: invalid key")
+	}
+	return nil
+}
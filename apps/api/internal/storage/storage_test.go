@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPut_RejectsUnsafeKeys(t *testing.T) {
+	Default = NewMemoryStorage("https://cdn.example.com/")
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "nested", key: "avatars/user/a.png"},
+		{name: "empty", key: "", wantErr: true},
+		{name: "absolute", key: "/etc/passwd", wantErr: true},
+		{name: "parent", key: "../secrets", wantErr: true},
+		{name: "unclean", key: "avatars/../../x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Put(context.Background(), tt.key, "image/png", strings.NewReader("x"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Put() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyFromURL(t *testing.T) {
+	Default = NewMemoryStorage("https://cdn.example.com/uploads")
+
+	url, err := Put(context.Background(), "avatars/a.png", "image/png", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if url != "https://cdn.example.com/uploads/avatars/a.png" {
+		t.Errorf("URL = %q", url)
+	}
+
+	if key, ok := KeyFromURL(url); !ok || key != "avatars/a.png" {
+		t.Errorf("KeyFromURL() = %q, %v", key, ok)
+	}
+
+	if _, ok := KeyFromURL("https://lh3.googleusercontent.com/a/photo"); ok {
+		t.Error("URLs we didn't issue should not map to a key")
+	}
+}
+
+func TestLocalStorage_PutAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, "http://localhost:5000/uploads")
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	if err := s.Put(context.Background(), "avatars/u/a.png", "image/png", strings.NewReader("png")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "avatars", "u", "a.png"))
+	if err != nil || string(data) != "png" {
+		t.Fatalf("Stored file = %q, %v", data, err)
+	}
+
+	if err := s.Delete(context.Background(), "avatars/u/a.png"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := s.Delete(context.Background(), "avatars/u/a.png"); err != nil {
+		t.Errorf("Deleting a missing object should succeed, got %v", err)
+	}
+}
+
+func TestMemoryStorage_Handler(t *testing.T) {
+	Default = NewMemoryStorage("http://localhost:5000/uploads")
+
+	if _, err := Put(context.Background(), "avatars/u/a.png", "image/png", strings.NewReader("png")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	h, ok := Handler()
+	if !ok {
+		t.Fatal("MemoryStorage should be served by the API")
+	}
+	uploads := http.StripPrefix("/uploads", h)
+
+	w := httptest.NewRecorder()
+	uploads.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uploads/avatars/u/a.png", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "png" || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("GET stored object = %d %q %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	uploads.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uploads/avatars/u/missing.png", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET missing object = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestLocalStorage_HandlerHidesDirectories(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "http://localhost:5000/uploads")
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	if err := s.Put(context.Background(), "avatars/u/a.png", "image/png", strings.NewReader("png")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	uploads := http.StripPrefix("/uploads", s.Handler())
+
+	w := httptest.NewRecorder()
+	uploads.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uploads/avatars/u/a.png", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "png" {
+		t.Errorf("GET stored file = %d %q", w.Code, w.Body.String())
+	}
+
+	for _, dir := range []string{"/uploads/", "/uploads/avatars/", "/uploads/avatars/u/", "/uploads/avatars"} {
+		w := httptest.NewRecorder()
+		uploads.ServeHTTP(w, httptest.NewRequest(http.MethodGet, dir, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", dir, w.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the caller's IP address. Behind a proxy, run chi's
+// middleware.RealIP first so RemoteAddr holds the real client.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// maxUserAgentLength caps what we keep of a client's User-Agent header
+const maxUserAgentLength = 512
+
+// UserAgent returns the caller's User-Agent header, cut to a length that's
+// safe to store
+func UserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ua
+}
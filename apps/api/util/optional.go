@@ -0,0 +1,30 @@
+package util
+
+import "encoding/json"
+
+// Optional is a JSON field for partial updates. It tells apart a field that
+// was left out, one set to null, and one given a value.
+type Optional[T any] struct {
+	// Set is whether the field appeared in the JSON at all
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// Ptr returns the value, or nil if it was null
+func (o Optional[T]) Ptr() *T {
+	if o.Null {
+		return nil
+	}
+	v := o.Value
+	return &v
+}
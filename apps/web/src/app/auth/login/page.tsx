@@ -2,6 +2,7 @@
 
 import { signIn } from "next-auth/react";
 import Link from "next/link";
+import { signInWithGoogle } from "@/lib/features/auth/google";
 import { useRouter } from "next/navigation";
 import { useState } from "react";
 
@@ -121,7 +122,7 @@ export default function LoginPage() {
                         {/* Social Login Buttons */}
                         <div className="space-y-3">
                             <button
-                                onClick={() => signIn("google", { redirectTo: "/dashboard" })}
+                                onClick={() => signInWithGoogle("/dashboard")}
                                 className="w-full flex items-center justify-center gap-3 py-3.5 border border-gray-900 rounded-lg hover:bg-gray-50 transition-colors font-medium text-gray-900"
                             >
                                 <svg className="w-5 h-5" viewBox="0 0 24 24">
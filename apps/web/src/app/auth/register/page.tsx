@@ -4,6 +4,7 @@ import { useState } from "react";
 import { useRouter } from "next/navigation";
 import { signIn } from "next-auth/react";
 import Link from "next/link";
+import { signInWithGoogle } from "@/lib/features/auth/google";
 
 export default function RegisterPage() {
     const [name, setName] = useState("")
@@ -62,7 +63,7 @@ export default function RegisterPage() {
                         {/* Social Login Buttons */}
                         <div className="space-y-3 mb-6">
                             <button
-                                onClick={() => signIn("google", { redirectTo: "/dashboard" })}
+                                onClick={() => signInWithGoogle("/dashboard")}
                                 className="w-full flex items-center justify-center gap-3 py-3.5 border border-gray-900 rounded-lg hover:bg-gray-50 transition-colors font-medium text-gray-900"
                             >
                                 <svg className="w-5 h-5" viewBox="0 0 24 24">
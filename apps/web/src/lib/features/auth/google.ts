@@ -0,0 +1,15 @@
+'use client'
+
+import { signIn } from "next-auth/react"
+
+const API_URL = process.env.NEXT_PUBLIC_API_URL || "http://localhost:5000"
+
+// signInWithGoogle asks the API for a one-time nonce and has Google sign it
+// into the ID token, so the API can tell the token belongs to this login
+export async function signInWithGoogle(redirectTo: string) {
+    const res = await fetch(`${API_URL}/api/v1/auth/oauth/nonce`, { method: "POST" })
+    if (!res.ok) throw new Error("Failed to start Google sign in")
+
+    const { nonce } = await res.json()
+    return signIn("google", { redirectTo }, { nonce })
+}
@@ -16,6 +16,14 @@ async function refreshAccessToken(refreshToken: string) {
     return res.json()
 }
 
+// idTokenNonce reads back the nonce the API issued for this login. The API
+// checks the token's signature and that the nonce is one it handed out.
+function idTokenNonce(idToken: string): string | undefined {
+    const payload = idToken.split(".")[1]
+    if (!payload) return undefined
+    return JSON.parse(Buffer.from(payload, "base64url").toString()).nonce
+}
+
 export const { handlers, signIn, signOut, auth } = NextAuth({
     providers: [
         Google({
@@ -26,6 +34,7 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
             credentials: {
                 email: { label: "Email", type: "email" },
                 password: { label: "Password", type: "password" },
+                code: { label: "Two-factor code", type: "text" },
             },
             async authorize(credentials) {
                 const res = await fetch(`${API_URL}/api/v1/auth/login`, {
@@ -39,7 +48,25 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
 
                 if (!res.ok) return null
 
-                const data = await res.json()
+                let data = await res.json()
+
+                // Accounts with two-factor enabled get a challenge instead of tokens
+                if (data.mfa_required) {
+                    if (!credentials?.code) return null
+
+                    const mfaRes = await fetch(`${API_URL}/api/v1/auth/mfa/verify`, {
+                        method: "POST",
+                        headers: { "Content-Type": "application/json" },
+                        body: JSON.stringify({
+                            mfa_token: data.mfa_token,
+                            code: credentials.code,
+                        }),
+                    })
+
+                    if (!mfaRes.ok) return null
+
+                    data = await mfaRes.json()
+                }
 
                 return {
                     id: data.user.id,
@@ -98,11 +125,12 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
             const res = await fetch(`${API_URL}/api/v1/auth/oauth`, {
                 method: "POST",
                 headers: { "Content-Type": "application/json" },
+                // The API verifies the ID token itself rather than trusting
+                // profile fields we forward
                 body: JSON.stringify({
                     provider: account?.provider,
-                    email: user.email,
-                    name: user.name,
-                    avatar_url: user.image,
+                    id_token: account?.id_token,
+                    nonce: account?.id_token && idTokenNonce(account.id_token),
                 }),
             })
 
@@ -116,6 +144,18 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
             return true
         },
     },
+    events: {
+        async signOut(message) {
+            // Revoke the refresh token family so it can't outlive the session
+            if (!("token" in message) || !message.token?.refreshToken) return
+
+            await fetch(`${API_URL}/api/v1/auth/logout`, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ refresh_token: message.token.refreshToken }),
+            }).catch(() => {})
+        },
+    },
     pages: {
         signIn: "/auth/login",
     },
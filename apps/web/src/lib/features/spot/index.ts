@@ -9,6 +9,7 @@ export const spotsApi = {
     create: (data: CreateSpotInput) => serverApi.post<Spot>("/api/v1/spots", data),
     update: (id: string, data: UpdateSpotInput) => serverApi.put<Spot>(`/api/v1/spots/${id}`, data),
     delete: (id: string) => serverApi.delete<{ message: string }>(`/api/v1/spots/${id}`),
+    publish: (id: string) => serverApi.post<Spot>(`/api/v1/spots/${id}/publish`, {}),
 }
 
 // For client components
@@ -18,4 +19,5 @@ export const spotsClientApi = {
     create: (data: CreateSpotInput) => clientApi.post<Spot>("/api/v1/spots", data),
     update: (id: string, data: UpdateSpotInput) => clientApi.put<Spot>(`/api/v1/spots/${id}`, data),
     delete: (id: string) => clientApi.delete<{ message: string }>(`/api/v1/spots/${id}`),
+    publish: (id: string) => clientApi.post<Spot>(`/api/v1/spots/${id}/publish`, {}),
 }
\ No newline at end of file